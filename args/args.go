@@ -19,8 +19,13 @@ package args
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	goflag "flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -35,6 +40,7 @@ import (
 	"k8s.io/gengo/types"
 
 	"github.com/spf13/pflag"
+	"k8s.io/klog"
 )
 
 // Default returns a defaulted GeneratorArgs. You may change the defaults
@@ -45,6 +51,7 @@ func Default() *GeneratorArgs {
 		GoHeaderFilePath:           filepath.Join(DefaultSourceTree(), "k8s.io/gengo/boilerplate/boilerplate.go.txt"),
 		GeneratedBuildTag:          "ignore_autogenerated",
 		GeneratedByCommentTemplate: "// Code generated by GENERATOR_NAME. DO NOT EDIT.",
+		VerifyDiffContext:          generator.DefaultDiffContext,
 		defaultCommandLineFlags:    true,
 	}
 }
@@ -74,6 +81,72 @@ type GeneratorArgs struct {
 	// If true, only verify, don't write anything.
 	VerifyOnly bool
 
+	// The number of lines of context in the diffs shown for stale files when
+	// verifying.
+	VerifyDiffContext int
+
+	// If set when verifying, a patch which brings all stale and missing
+	// files up to date is written to this file. It applies in OutputBase
+	// with `patch -p1` or `git apply`.
+	VerifyPatchFile string
+
+	// If set when verifying, a report listing the status of every file is
+	// written to this file: JUnit XML if it ends in ".xml", JSON otherwise.
+	VerifyReportFile string
+
+	// If true, existing files are overwritten even if they don't have the
+	// generated-code marker of GeneratedByCommentTemplate (see
+	// GeneratedMarker), i.e. even if they look like they were written by
+	// hand.
+	ForceOverwrite bool
+
+	// If true, files in the output packages which carry GeneratedBuildTag or
+	// the GeneratedByCommentTemplate comment, but which are no longer
+	// generated, are removed (or reported, with VerifyOnly). Only enable this
+	// if the build tag is unique to this command.
+	CleanOrphans bool
+
+	// If set, a manifest of what each output package was generated from is
+	// kept in this file, and packages whose inputs haven't changed since the
+	// last run are skipped. See generator.Manifest.
+	ManifestFile string
+
+	// Identifies the version of the generator in the manifest. Defaults to a
+	// hash of the running executable.
+	GeneratorVersion string
+
+	// If true, generated Go files are type-checked with the existing sources
+	// of their packages before being written. See
+	// generator.Context.TypeCheck.
+	TypeCheck bool
+
+	// If either is set, the output of each generator is split across
+	// several files once it has more types, or more bytes of code, than
+	// this. See generator.ShardPolicy.
+	ShardMaxTypes int
+	ShardMaxBytes int
+
+	// How generated Go files are mapped back to the generators and types
+	// which produced them: "comments", "json", or empty for not at all. See
+	// generator.Context.SourceMap.
+	SourceMap string
+
+	// If true, Go files are formatted with generator.FormatGoSource instead of
+	// imports.Process, which also adds the imports generators didn't declare.
+	// It is much faster.
+	DeclaredImportsOnly bool
+
+	// Explicit names to import packages with, by import path. See
+	// namer.ImportAliasPolicy.
+	ImportAliases map[string]string
+
+	// Rules naming imported packages by path pattern, of the form
+	// "pattern=segments", e.g. "k8s.io/api/*/*=2".
+	ImportAliasRules []string
+
+	// Names never given to imported packages.
+	ReservedImportNames []string
+
 	// If true, include *_test.go files
 	IncludeTestFiles bool
 
@@ -83,6 +156,24 @@ type GeneratorArgs struct {
 	// keep tags distinct as well.
 	GeneratedBuildTag string
 
+	// Build tags of other generated files which are ignored when parsing,
+	// in addition to GeneratedBuildTag, e.g. those of the other generators
+	// run by a driver.
+	IgnoredBuildTags []string
+
+	// If set, the memory layout of types is computed for this GOARCH (e.g.
+	// "amd64") and recorded in the universe. See types.Universe.Layout.
+	LayoutArch string
+
+	// The maximum number of output packages to generate at the same time.
+	// See generator.Context.Parallelism.
+	Parallelism int
+
+	// If set, generated files are written to this tar (".tar") or zip
+	// (".zip") archive instead of under OutputBase. Entries are named
+	// relative to OutputBase.
+	OutputArchive string
+
 	// Any custom arguments go here
 	CustomArgs interface{}
 
@@ -103,7 +194,25 @@ func (g *GeneratorArgs) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVarP(&g.OutputFileBaseName, "output-file-base", "O", g.OutputFileBaseName, "Base name (without .go suffix) for output files.")
 	fs.StringVarP(&g.GoHeaderFilePath, "go-header-file", "h", g.GoHeaderFilePath, "File containing boilerplate header text. The string YEAR will be replaced with the current 4-digit year.")
 	fs.BoolVar(&g.VerifyOnly, "verify-only", g.VerifyOnly, "If true, only verify existing output, do not write anything.")
+	fs.IntVar(&g.VerifyDiffContext, "verify-diff-context", g.VerifyDiffContext, "The number of lines of context in the diffs of stale files shown by --verify-only.")
+	fs.StringVar(&g.VerifyPatchFile, "verify-patch", g.VerifyPatchFile, "If set with --verify-only, write a patch which updates all stale and missing files to this file.")
+	fs.StringVar(&g.VerifyReportFile, "verify-report", g.VerifyReportFile, "If set with --verify-only, write a report of the status of every file to this file, as JUnit XML if it ends in .xml and JSON otherwise.")
+	fs.StringVar(&g.ManifestFile, "manifest", g.ManifestFile, "If set, record what each output package was generated from in this file, and skip packages whose inputs haven't changed since.")
+	fs.StringVar(&g.GeneratorVersion, "generator-version", g.GeneratorVersion, "The version of the generator recorded in the manifest. Defaults to a hash of the executable.")
+	fs.BoolVar(&g.TypeCheck, "type-check", g.TypeCheck, "If true, type-check the generated Go files of each package before writing them, and fail if they don't compile.")
+	fs.IntVar(&g.ShardMaxTypes, "shard-max-types", g.ShardMaxTypes, "If set, split the output of each generator across several files, so that each file has about this many types at most.")
+	fs.IntVar(&g.ShardMaxBytes, "shard-max-bytes", g.ShardMaxBytes, "If set, split the output of each generator across several files, so that the code for the types in each file is about this many bytes at most.")
+	fs.StringVar(&g.SourceMap, "source-map", g.SourceMap, "If \"comments\", annotate each part of the generated Go files with the generator and input type that produced it; if \"json\", write the same information to a .map.json file next to each one.")
+	fs.BoolVar(&g.DeclaredImportsOnly, "declared-imports-only", g.DeclaredImportsOnly, "If true, format Go files without goimports, keeping only the imports the generators declared. This is much faster.")
+	fs.StringToStringVar(&g.ImportAliases, "import-alias", g.ImportAliases, "Names to import packages with in generated code, as path=name pairs.")
+	fs.StringSliceVar(&g.ImportAliasRules, "import-alias-rule", g.ImportAliasRules, "Rules naming imported packages, as pattern=segments: packages matching the pattern are named after that many of their trailing path segments, e.g. k8s.io/api/*/*=2.")
+	fs.StringSliceVar(&g.ReservedImportNames, "reserved-import-names", g.ReservedImportNames, "Names never given to imported packages in generated code.")
+	fs.BoolVar(&g.ForceOverwrite, "force-overwrite", g.ForceOverwrite, "If true, overwrite existing files even if they don't have a generated-code comment.")
+	fs.BoolVar(&g.CleanOrphans, "clean-orphans", g.CleanOrphans, "If true, remove files carrying this command's build tag or generated-by comment which are no longer generated (with --verify-only, report them). The build tag must be unique to this command.")
 	fs.StringVar(&g.GeneratedBuildTag, "build-tag", g.GeneratedBuildTag, "A Go build tag to use to identify files generated by this command. Should be unique.")
+	fs.StringVar(&g.OutputArchive, "output-archive", g.OutputArchive, "If set, write generated files to this .tar or .zip archive instead of the output base.")
+	fs.IntVar(&g.Parallelism, "parallelism", g.Parallelism, "The maximum number of output packages to generate at the same time.")
+	fs.StringVar(&g.LayoutArch, "layout-arch", g.LayoutArch, "If set, compute the size, alignment and field offsets of types for this GOARCH.")
 }
 
 // LoadGoBoilerplate loads the boilerplate file passed to --go-header-file.
@@ -118,17 +227,94 @@ func (g *GeneratorArgs) LoadGoBoilerplate() ([]byte, error) {
 		if len(b) != 0 {
 			b = append(b, byte('\n'))
 		}
-		generatorName := path.Base(os.Args[0])
-		generatedByComment := strings.Replace(g.GeneratedByCommentTemplate, "GENERATOR_NAME", generatorName, -1)
-		s := fmt.Sprintf("%s\n\n", generatedByComment)
+		s := fmt.Sprintf("%s\n\n", g.generatedByComment())
 		b = append(b, []byte(s)...)
 	}
 	return b, nil
 }
 
+// generatedByComment returns the GeneratedByCommentTemplate comment for this
+// command.
+func (g *GeneratorArgs) generatedByComment() string {
+	generatorName := path.Base(os.Args[0])
+	return strings.Replace(g.GeneratedByCommentTemplate, "GENERATOR_NAME", generatorName, -1)
+}
+
+// ShardPolicy returns the policy set by ShardMaxTypes and ShardMaxBytes, or nil
+// if neither is set.
+func (g *GeneratorArgs) ShardPolicy() *generator.ShardPolicy {
+	if g.ShardMaxTypes <= 0 && g.ShardMaxBytes <= 0 {
+		return nil
+	}
+	return &generator.ShardPolicy{MaxTypes: g.ShardMaxTypes, MaxBytes: g.ShardMaxBytes}
+}
+
+// SourceMapMode returns the source map mode set by SourceMap.
+func (g *GeneratorArgs) SourceMapMode() (generator.SourceMapMode, error) {
+	switch m := generator.SourceMapMode(g.SourceMap); m {
+	case generator.SourceMapNone, generator.SourceMapComments, generator.SourceMapJSON:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid --source-map %q: must be %q or %q", g.SourceMap, generator.SourceMapComments, generator.SourceMapJSON)
+	}
+}
+
+// ImportAliasPolicy returns the policy set by ImportAliases, ImportAliasRules
+// and ReservedImportNames, or nil if none of them is set.
+func (g *GeneratorArgs) ImportAliasPolicy() (*namer.ImportAliasPolicy, error) {
+	if len(g.ImportAliases) == 0 && len(g.ImportAliasRules) == 0 && len(g.ReservedImportNames) == 0 {
+		return nil, nil
+	}
+	policy := &namer.ImportAliasPolicy{
+		Aliases:  g.ImportAliases,
+		Reserved: g.ReservedImportNames,
+	}
+	for _, r := range g.ImportAliasRules {
+		rule, err := namer.ParseImportAliasRule(r)
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+	return policy, nil
+}
+
+// GeneratedMarker returns the part of GeneratedByCommentTemplate which all
+// generated files have in common, whichever command generated them, e.g.
+// "// Code generated by". It is "" if there is no template, or if
+// ForceOverwrite is set. See generator.Context.GeneratedMarker.
+func (g *GeneratorArgs) GeneratedMarker() string {
+	if g.ForceOverwrite {
+		return ""
+	}
+	marker := g.GeneratedByCommentTemplate
+	if i := strings.Index(marker, "GENERATOR_NAME"); i >= 0 {
+		marker = marker[:i]
+	}
+	return strings.TrimSpace(marker)
+}
+
+// OrphanMarkers returns what identifies the files generated by this command,
+// for generator.Context.OrphanMarkers: its build tag and generated-by comment.
+func (g *GeneratorArgs) OrphanMarkers() []string {
+	markers := []string{}
+	if g.GeneratedBuildTag != "" {
+		markers = append(markers, "+build !"+g.GeneratedBuildTag, "go:build !"+g.GeneratedBuildTag)
+	}
+	if g.GeneratedByCommentTemplate != "" {
+		markers = append(markers, g.generatedByComment())
+	}
+	return markers
+}
+
 // NewBuilder makes a new parser.Builder and populates it with the input
 // directories.
 func (g *GeneratorArgs) NewBuilder() (*parser.Builder, error) {
+	return g.NewBuilderContext(context.Background())
+}
+
+// NewBuilderContext is like NewBuilder, but stops parsing once ctx is done.
+func (g *GeneratorArgs) NewBuilderContext(ctx context.Context) (*parser.Builder, error) {
 	b := parser.New()
 
 	// flag for including *_test.go
@@ -136,15 +322,25 @@ func (g *GeneratorArgs) NewBuilder() (*parser.Builder, error) {
 
 	// Ignore all auto-generated files.
 	b.AddBuildTags(g.GeneratedBuildTag)
+	b.AddBuildTags(g.IgnoredBuildTags...)
+
+	if g.LayoutArch != "" {
+		if err := b.ComputeLayouts(g.LayoutArch); err != nil {
+			return nil, err
+		}
+	}
 
 	for _, d := range g.InputDirs {
 		var err error
 		if strings.HasSuffix(d, "/...") {
-			err = b.AddDirRecursive(strings.TrimSuffix(d, "/..."))
+			err = b.AddDirRecursiveContext(ctx, strings.TrimSuffix(d, "/..."))
 		} else {
-			err = b.AddDir(d)
+			err = b.AddDirContext(ctx, d)
 		}
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
 			return nil, fmt.Errorf("unable to add directory %q: %v", d, err)
 		}
 	}
@@ -169,6 +365,199 @@ func (g *GeneratorArgs) InputIncludes(p *types.Package) bool {
 	return false
 }
 
+// ConfigureContext sets up c to write, or verify, generated files as these
+// arguments say: everything but the orphans to remove (see OrphanMarkers) and
+// the output archive (see OpenOutputArchive). It also reads the manifest (see
+// UseManifest).
+func (g *GeneratorArgs) ConfigureContext(c *generator.Context) error {
+	var err error
+	c.Verify = g.VerifyOnly
+	c.DiffContext = g.VerifyDiffContext
+	c.Parallelism = g.Parallelism
+	c.GeneratedMarker = g.GeneratedMarker()
+	c.TypeCheck = g.TypeCheck
+	c.Sharding = g.ShardPolicy()
+	if c.SourceMap, err = g.SourceMapMode(); err != nil {
+		return err
+	}
+	if c.ImportAliasPolicy, err = g.ImportAliasPolicy(); err != nil {
+		return err
+	}
+	if g.DeclaredImportsOnly {
+		c.FileTypes[generator.GolangFileType] = generator.NewGolangFileWithDeclaredImports()
+	}
+	return g.UseManifest(c)
+}
+
+// OutputArchive is the archive named by GeneratorArgs.OutputArchive, as it is
+// being written. A nil *OutputArchive does nothing.
+type OutputArchive struct {
+	file    *os.File
+	archive io.Closer
+}
+
+// OpenOutputArchive creates the archive named by OutputArchive, if any, and
+// makes c write to it. Once all the files have been written, call Finish;
+// call Close in any case. Since an archive has no existing files to compare
+// with, it can't be used with VerifyOnly.
+func (g *GeneratorArgs) OpenOutputArchive(c *generator.Context) (*OutputArchive, error) {
+	if g.OutputArchive == "" {
+		return nil, nil
+	}
+	if g.VerifyOnly {
+		return nil, fmt.Errorf("--verify-only can't be used with --output-archive")
+	}
+	f, err := os.Create(g.OutputArchive)
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating the output archive: %v", err)
+	}
+	a := &OutputArchive{file: f}
+	switch filepath.Ext(g.OutputArchive) {
+	case ".zip":
+		out := generator.NewZipOutput(f, g.OutputBase)
+		c.Output, a.archive = out, out
+	default:
+		out := generator.NewTarOutput(f, g.OutputBase)
+		c.Output, a.archive = out, out
+	}
+	return a, nil
+}
+
+// Finish writes the end of the archive.
+func (a *OutputArchive) Finish() error {
+	if a == nil {
+		return nil
+	}
+	if err := a.archive.Close(); err != nil {
+		return fmt.Errorf("Failed writing the output archive: %v", err)
+	}
+	return nil
+}
+
+// Close closes the archive's file, finished or not.
+func (a *OutputArchive) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// UseManifest reads the manifest named by ManifestFile, if any, into c.
+func (g *GeneratorArgs) UseManifest(c *generator.Context) error {
+	if g.ManifestFile == "" {
+		return nil
+	}
+	m, err := generator.ReadManifest(generator.DiskOutput{}, g.ManifestFile)
+	if err != nil {
+		return fmt.Errorf("Failed reading the manifest: %v", err)
+	}
+	c.Manifest = m
+	c.GeneratorVersion = g.GeneratorVersion
+	if c.GeneratorVersion == "" {
+		c.GeneratorVersion = executableHash()
+	}
+	c.GeneratorSettings = g.ManifestSettings()
+	return nil
+}
+
+// ManifestSettings describes the arguments which may change what is generated,
+// including CustomArgs, for generator.Context.GeneratorSettings. Those already
+// accounted for by the manifest (the inputs and the header), and those which
+// only change how the generators run, are left out.
+func (g *GeneratorArgs) ManifestSettings() string {
+	settings := *g
+	settings.InputDirs = nil
+	settings.OutputBase = ""
+	settings.GoHeaderFilePath = ""
+	settings.VerifyOnly = false
+	settings.VerifyDiffContext = 0
+	settings.VerifyPatchFile = ""
+	settings.VerifyReportFile = ""
+	settings.ForceOverwrite = false
+	settings.CleanOrphans = false
+	settings.ManifestFile = ""
+	settings.GeneratorVersion = ""
+	settings.TypeCheck = false
+	settings.Parallelism = 0
+	settings.OutputArchive = ""
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Sprintf("%+v", settings)
+	}
+	return string(encoded)
+}
+
+// SaveManifest logs what the manifest in c allowed to skip, and writes it back
+// to ManifestFile, unless verifying.
+func (g *GeneratorArgs) SaveManifest(c *generator.Context) error {
+	if c.Manifest == nil {
+		return nil
+	}
+	skipped := 0
+	for _, r := range c.ManifestResults() {
+		if r.Skipped {
+			skipped++
+			continue
+		}
+		klog.V(1).Infof("Package %q is affected by changes to: %s", r.Package, strings.Join(r.Changes, ", "))
+	}
+	klog.Infof("Skipped %d packages whose inputs have not changed", skipped)
+	if c.Verify {
+		return nil
+	}
+	if err := c.Manifest.Write(generator.DiskOutput{}, g.ManifestFile); err != nil {
+		return fmt.Errorf("Failed writing the manifest: %v", err)
+	}
+	return nil
+}
+
+// executableHash returns a hash of the running executable, or "" if it can't
+// be read.
+func executableHash() string {
+	path, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WriteVerifyOutputs writes the patch and report requested by VerifyPatchFile
+// and VerifyReportFile, from what verifying with c found. Call it after
+// executing packages, whether or not that failed.
+func (g *GeneratorArgs) WriteVerifyOutputs(c *generator.Context) error {
+	if g.VerifyPatchFile != "" {
+		if err := ioutil.WriteFile(g.VerifyPatchFile, c.VerifyPatch(), 0644); err != nil {
+			return fmt.Errorf("Failed writing the verification patch: %v", err)
+		}
+	}
+	if g.VerifyReportFile != "" {
+		report := generator.NewVerifyReport(c.VerifyResults())
+		buf := &bytes.Buffer{}
+		var err error
+		if filepath.Ext(g.VerifyReportFile) == ".xml" {
+			err = report.WriteJUnit(buf)
+		} else {
+			err = report.WriteJSON(buf)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(g.VerifyReportFile, buf.Bytes(), 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed writing the verification report: %v", err)
+		}
+	}
+	return nil
+}
+
 // DefaultSourceTree returns the /src directory of the first entry in $GOPATH.
 // If $GOPATH is empty, it returns "./". Useful as a default output location.
 func DefaultSourceTree() string {
@@ -183,29 +572,62 @@ func DefaultSourceTree() string {
 // If you don't need any non-default behavior, use as:
 // args.Default().Execute(...)
 func (g *GeneratorArgs) Execute(nameSystems namer.NameSystems, defaultSystem string, pkgs func(*generator.Context, *GeneratorArgs) generator.Packages) error {
+	return g.ExecuteContext(context.Background(), nameSystems, defaultSystem, pkgs)
+}
+
+// ExecuteContext is like Execute, but stops parsing and generation once ctx is
+// done. In that case the returned error wraps ctx.Err(), so it can be
+// recognized with errors.Is.
+func (g *GeneratorArgs) ExecuteContext(ctx context.Context, nameSystems namer.NameSystems, defaultSystem string, pkgs func(*generator.Context, *GeneratorArgs) generator.Packages) error {
 	if g.defaultCommandLineFlags {
 		g.AddFlags(pflag.CommandLine)
 		pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
 		pflag.Parse()
 	}
 
-	b, err := g.NewBuilder()
+	b, err := g.NewBuilderContext(ctx)
 	if err != nil {
-		return fmt.Errorf("Failed making a parser: %v", err)
+		return fmt.Errorf("Failed making a parser: %w", err)
 	}
 
 	// pass through the flag on whether to include *_test.go files
 	b.IncludeTestFiles = g.IncludeTestFiles
 
-	c, err := generator.NewContext(b, nameSystems, defaultSystem)
+	c, err := generator.NewContextWithContext(ctx, b, nameSystems, defaultSystem)
 	if err != nil {
-		return fmt.Errorf("Failed making a context: %v", err)
+		return fmt.Errorf("Failed making a context: %w", err)
 	}
 
-	c.Verify = g.VerifyOnly
+	if err := g.ConfigureContext(c); err != nil {
+		return err
+	}
+	if g.CleanOrphans {
+		c.OrphanMarkers = g.OrphanMarkers()
+	}
+	archive, err := g.OpenOutputArchive(c)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
 	packages := pkgs(c, g)
-	if err := c.ExecutePackages(g.OutputBase, packages); err != nil {
-		return fmt.Errorf("Failed executing generator: %v", err)
+	err = c.ExecutePackagesContext(ctx, g.OutputBase, packages)
+	if c.Verify {
+		if err := g.WriteVerifyOutputs(c); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Failed executing generator: %w", err)
+	}
+	if err := g.SaveManifest(c); err != nil {
+		return err
+	}
+	if err := archive.Finish(); err != nil {
+		return err
+	}
+	if !c.Verify {
+		summary := c.WriteSummary()
+		klog.Infof("Wrote %d files, %d were unchanged", summary.Written, summary.Unchanged)
 	}
 
 	return nil
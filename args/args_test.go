@@ -17,8 +17,11 @@ limitations under the License.
 package args
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
+	"k8s.io/gengo/generator"
 	"k8s.io/gengo/types"
 )
 
@@ -33,3 +36,26 @@ func TestInputIncludes(t *testing.T) {
 		t.Errorf("Expected correctness")
 	}
 }
+
+func TestGeneratedMarker(t *testing.T) {
+	g := Default()
+	if e, a := "// Code generated by", g.GeneratedMarker(); e != a {
+		t.Errorf("wanted %q, got %q", e, a)
+	}
+	g.ForceOverwrite = true
+	if m := g.GeneratedMarker(); m != "" {
+		t.Errorf("expected no marker with ForceOverwrite, got %q", m)
+	}
+}
+
+func TestOpenOutputArchiveVerifyOnly(t *testing.T) {
+	g := Default()
+	g.OutputArchive = filepath.Join(os.TempDir(), "gengo-verify-only.tar")
+	g.VerifyOnly = true
+	if _, err := g.OpenOutputArchive(&generator.Context{}); err == nil {
+		t.Errorf("expected an error verifying against an archive")
+	}
+	if _, err := os.Stat(g.OutputArchive); !os.IsNotExist(err) {
+		t.Errorf("expected the archive not to be created, got %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package driver runs several generators from a single command, parsing their
+// inputs only once.
+//
+// Each generator registers what it would otherwise pass to
+// args.GeneratorArgs.Execute, along with its own GeneratorArgs:
+//
+//	r := &driver.Registry{}
+//	r.Register(&driver.Generator{
+//		Name:              "deepcopy",
+//		Args:              deepcopyArgs,
+//		NameSystems:       deepcopy.NameSystems(),
+//		DefaultNameSystem: deepcopy.DefaultNameSystem(),
+//		Packages:          deepcopy.Packages,
+//	})
+//	...
+//	r.Main()
+//
+// The driver parses the union of all the generators' input directories, and
+// runs each generator against a context which shares the resulting universe.
+package driver // import "k8s.io/gengo/driver"
+
+import (
+	goflag "flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/gengo/args"
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/types"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+// Generator is a generator registered with the driver.
+type Generator struct {
+	// The name of the generator. It prefixes the generator's command-line
+	// flags, e.g. "--deepcopy-output-file-base".
+	Name string
+
+	// The generator's arguments. Its InputDirs default to those given to
+	// the driver; OutputBase, GoHeaderFilePath and VerifyOnly always come
+	// from the driver.
+	Args *args.GeneratorArgs
+
+	// Optional; adds the generator's custom flags, which will be prefixed by
+	// its name.
+	AddFlags func(*pflag.FlagSet)
+
+	// What would otherwise be passed to args.GeneratorArgs.Execute.
+	NameSystems       namer.NameSystems
+	DefaultNameSystem string
+	Packages          func(*generator.Context, *args.GeneratorArgs) generator.Packages
+}
+
+// The flags of GeneratorArgs which are set per generator.
+var generatorFlags = []string{"input-dirs", "output-package", "output-file-base", "build-tag"}
+
+// Registry holds the generators a driver can run.
+type Registry struct {
+	generators []*Generator
+	byName     map[string]*Generator
+}
+
+// Register adds a generator. Generators run in the order they are registered.
+func (r *Registry) Register(g *Generator) error {
+	if r.byName == nil {
+		r.byName = map[string]*Generator{}
+	}
+	if _, found := r.byName[g.Name]; found {
+		return fmt.Errorf("generator %q is already registered", g.Name)
+	}
+	if g.Args == nil {
+		g.Args = args.Default().WithoutDefaultFlagParsing()
+	}
+	r.byName[g.Name] = g
+	r.generators = append(r.generators, g)
+	return nil
+}
+
+// Names returns the names of the registered generators, in order.
+func (r *Registry) Names() []string {
+	names := []string{}
+	for _, g := range r.generators {
+		names = append(names, g.Name)
+	}
+	return names
+}
+
+// AddFlags adds the flags of every registered generator to fs, prefixed by
+// the generator's name.
+func (r *Registry) AddFlags(fs *pflag.FlagSet) {
+	for _, g := range r.generators {
+		own := pflag.NewFlagSet(g.Name, pflag.ContinueOnError)
+		g.Args.AddFlags(own)
+		for _, name := range generatorFlags {
+			f := own.Lookup(name)
+			fs.Var(f.Value, g.Name+"-"+f.Name, fmt.Sprintf("[%s] %s", g.Name, f.Usage))
+		}
+		if g.AddFlags != nil {
+			custom := pflag.NewFlagSet(g.Name, pflag.ContinueOnError)
+			g.AddFlags(custom)
+			custom.VisitAll(func(f *pflag.Flag) {
+				fs.Var(f.Value, g.Name+"-"+f.Name, fmt.Sprintf("[%s] %s", g.Name, f.Usage))
+			})
+		}
+	}
+}
+
+// Execute parses the inputs of the named generators (or of all of them, if
+// 'names' is empty) once, and runs each of them in turn. 'common' provides
+// the default input directories, and all the other settings but the output
+// package and file base, which are only set per generator.
+func (r *Registry) Execute(common *args.GeneratorArgs, names []string) error {
+	// These are only set per generator.
+	if common.OutputPackagePath != "" || common.OutputFileBaseName != "" {
+		return fmt.Errorf("the output package and file base are set per generator, with --<generator>-output-package and --<generator>-output-file-base")
+	}
+
+	selected := []*Generator{}
+	if len(names) == 0 {
+		selected = r.generators
+	}
+	for _, name := range names {
+		g, found := r.byName[name]
+		if !found {
+			return fmt.Errorf("unknown generator %q, expected one of %v", name, r.Names())
+		}
+		selected = append(selected, g)
+	}
+
+	// Parse the union of all inputs, ignoring the output of every generator.
+	parseArgs := *common
+	parseArgs.InputDirs = append([]string{}, common.InputDirs...)
+	parseArgs.IgnoredBuildTags = append([]string{}, common.IgnoredBuildTags...)
+	seen := map[string]bool{}
+	for _, dir := range common.InputDirs {
+		seen[dir] = true
+	}
+	// Each generator runs with a copy of its arguments, completed with the
+	// common ones, so that the registered ones can be executed again.
+	genArgs := map[*Generator]*args.GeneratorArgs{}
+	ownInputs := map[*Generator]bool{}
+	for _, g := range selected {
+		a := *g.Args
+		a.OutputBase = common.OutputBase
+		a.VerifyOnly = common.VerifyOnly
+		a.GoHeaderFilePath = common.GoHeaderFilePath
+		ownInputs[g] = len(a.InputDirs) > 0
+		if !ownInputs[g] {
+			a.InputDirs = common.InputDirs
+		}
+		genArgs[g] = &a
+		for _, dir := range a.InputDirs {
+			if !seen[dir] {
+				seen[dir] = true
+				parseArgs.InputDirs = append(parseArgs.InputDirs, dir)
+			}
+		}
+		parseArgs.IgnoredBuildTags = append(parseArgs.IgnoredBuildTags, a.GeneratedBuildTag)
+	}
+	b, err := parseArgs.NewBuilder()
+	if err != nil {
+		return fmt.Errorf("Failed making a parser: %v", err)
+	}
+	c, err := generator.NewContext(b, nil, "")
+	if err != nil {
+		return fmt.Errorf("Failed making a context: %v", err)
+	}
+	if err := common.ConfigureContext(c); err != nil {
+		return err
+	}
+	archive, err := common.OpenOutputArchive(c)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	var errors []string
+	for _, g := range selected {
+		klog.V(2).Infof("Running generator %q", g.Name)
+		a := genArgs[g]
+		gc := c.ForNameSystems(g.NameSystems, g.DefaultNameSystem)
+		gc.GeneratorSettings = c.GeneratorSettings + "\n" + a.ManifestSettings()
+		if ownInputs[g] {
+			gc.Inputs = inputsOf(c, a)
+		}
+		if err := gc.ExecutePackages(common.OutputBase, g.Packages(gc, a)); err != nil {
+			errors = append(errors, fmt.Sprintf("generator %q: %v", g.Name, err))
+		}
+	}
+	// Orphans are only known once all the generators have run, since they
+	// may share output directories. The generated-by comment names the
+	// driver rather than the generator, so only build tags identify a
+	// generator's files.
+	if common.CleanOrphans {
+		for _, g := range selected {
+			tagOnly := *genArgs[g]
+			tagOnly.GeneratedByCommentTemplate = ""
+			c.OrphanMarkers = append(c.OrphanMarkers, tagOnly.OrphanMarkers()...)
+		}
+		if len(errors) == 0 || c.Verify {
+			if err := c.RemoveOrphans(common.OutputBase); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+	if c.Verify {
+		if err := common.WriteVerifyOutputs(c); err != nil {
+			return err
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("some generators had errors:\n%v\n", strings.Join(errors, "\n"))
+	}
+	if err := common.SaveManifest(c); err != nil {
+		return err
+	}
+	return archive.Finish()
+}
+
+// inputsOf returns the inputs of the context which come from one of the
+// generator's input directories.
+func inputsOf(c *generator.Context, a *args.GeneratorArgs) []string {
+	inputs := []string{}
+	for _, path := range c.Inputs {
+		p := c.Universe[path]
+		if p == nil {
+			p = &types.Package{Path: path}
+		}
+		if a.InputIncludes(p) {
+			inputs = append(inputs, path)
+		}
+	}
+	return inputs
+}
+
+// Main implements main() for a driver command. In addition to the usual
+// generator flags (see args.GeneratorArgs.AddFlags) and those of every
+// registered generator, it accepts --generators to select which generators
+// to run.
+func (r *Registry) Main() {
+	common := args.Default().WithoutDefaultFlagParsing()
+	names := []string{}
+	common.AddFlags(pflag.CommandLine)
+	r.AddFlags(pflag.CommandLine)
+	pflag.CommandLine.StringSliceVar(&names, "generators", names, fmt.Sprintf("Comma-separated list of generators to run, out of %v. Defaults to all of them.", r.Names()))
+	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
+	pflag.Parse()
+
+	if err := r.Execute(common, names); err != nil {
+		klog.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	klog.V(2).Info("Completed successfully.")
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/gengo/args"
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/types"
+)
+
+func TestRegistryExecute(t *testing.T) {
+	seen := map[string][]string{}
+	universes := map[string]types.Universe{}
+	record := func(name string) func(*generator.Context, *args.GeneratorArgs) generator.Packages {
+		return func(c *generator.Context, a *args.GeneratorArgs) generator.Packages {
+			inputs := append([]string{}, c.Inputs...)
+			sort.Strings(inputs)
+			seen[name] = inputs
+			universes[name] = c.Universe
+			if _, found := c.Namers["public"]; !found {
+				t.Errorf("%s: the generator's name systems are missing", name)
+			}
+			return nil
+		}
+	}
+
+	r := &Registry{}
+	for _, name := range []string{"all", "b"} {
+		g := &Generator{
+			Name:              name,
+			NameSystems:       namer.NameSystems{"public": namer.NewPublicNamer(0)},
+			DefaultNameSystem: "public",
+			Packages:          record(name),
+		}
+		if name == "b" {
+			g.Args = args.Default().WithoutDefaultFlagParsing()
+			g.Args.InputDirs = []string{"k8s.io/gengo/testdata/a/b"}
+		}
+		if err := r.Register(g); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := r.Register(&Generator{Name: "b"}); err == nil {
+		t.Errorf("expected an error registering a generator twice")
+	}
+
+	common := args.Default().WithoutDefaultFlagParsing()
+	common.InputDirs = []string{"k8s.io/gengo/testdata/a"}
+	if err := r.Execute(common, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := []string{"k8s.io/gengo/testdata/a", "k8s.io/gengo/testdata/a/b"}, seen["all"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted inputs %v, got %v", e, a)
+	}
+	if e, a := []string{"k8s.io/gengo/testdata/a/b"}, seen["b"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted inputs %v, got %v", e, a)
+	}
+	if reflect.ValueOf(universes["all"]).Pointer() != reflect.ValueOf(universes["b"]).Pointer() {
+		t.Errorf("the generators did not share a universe")
+	}
+
+	// The registered arguments are left alone, so the next run defaults to
+	// its own inputs.
+	if dirs := r.byName["all"].Args.InputDirs; len(dirs) != 0 {
+		t.Errorf("expected the registered input directories to be left alone, got %v", dirs)
+	}
+	common.InputDirs = []string{"k8s.io/gengo/testdata/a/b"}
+	if err := r.Execute(common, []string{"all"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := []string{"k8s.io/gengo/testdata/a/b"}, seen["all"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted inputs %v, got %v", e, a)
+	}
+
+	if err := r.Execute(common, []string{"c"}); err == nil {
+		t.Errorf("expected an error for an unknown generator")
+	}
+}
+
+func TestRegistryExecuteSettings(t *testing.T) {
+	var universe types.Universe
+	r := &Registry{}
+	g := &Generator{
+		Name:              "tags",
+		NameSystems:       namer.NameSystems{"public": namer.NewPublicNamer(0)},
+		DefaultNameSystem: "public",
+		Packages: func(c *generator.Context, a *args.GeneratorArgs) generator.Packages {
+			universe = c.Universe
+			return nil
+		},
+	}
+	if err := r.Register(g); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	g.Args.GeneratedBuildTag = "tags_generated"
+
+	dir, err := ioutil.TempDir("", "driver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	common := args.Default().WithoutDefaultFlagParsing()
+	common.InputDirs = []string{"k8s.io/gengo/testdata/tags"}
+	common.OutputArchive = filepath.Join(dir, "out.tar")
+	if err := r.Execute(common, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pkg := universe.Package("k8s.io/gengo/testdata/tags")
+	if _, found := pkg.Types["Input"]; !found {
+		t.Errorf("expected the input type to be parsed, got %v", pkg.Types)
+	}
+	if _, found := pkg.Types["Generated"]; found {
+		t.Errorf("expected the file with the generator's build tag to be ignored")
+	}
+	if _, err := os.Stat(common.OutputArchive); err != nil {
+		t.Errorf("expected the output archive to be written: %v", err)
+	}
+
+	common.OutputPackagePath = "example.com/out"
+	if err := r.Execute(common, nil); err == nil {
+		t.Errorf("expected an error for an output package not set per generator")
+	}
+}
@@ -53,11 +53,10 @@ func DefaultNameSystem() string {
 // Packages makes the sets package definition.
 func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
 	context.FileTypes = map[string]generator.FileType{
-		jsonFileType: jsonFile{
-			c:        context,
+		jsonFileType: jsonFile{generator.DefaultFileType{
 			Format:   jsonFormat,
 			Assemble: jsonAssemble,
-		},
+		}},
 	}
 
 	return generator.Packages{&generator.DefaultPackage{
@@ -71,7 +70,7 @@ func Packages(context *generator.Context, arguments *args.GeneratorArgs) generat
 			generators = append(generators, &errCodeGen{
 				DefaultGen:    generator.DefaultGen{},
 				outputPackage: arguments.OutputPackagePath,
-				imports:       generator.NewImportTracker(),
+				imports:       c.NewImportTracker(),
 			})
 			return generators
 		},
@@ -384,40 +383,13 @@ func jsonAssemble(w io.Writer, f *generator.File) {
 	w.Write(f.Body.Bytes())
 }
 
+// jsonFile writes JSON files to the output, but doesn't verify them.
 type jsonFile struct {
-	c        *generator.Context
-	Format   func([]byte) ([]byte, error)
-	Assemble func(io.Writer, *generator.File)
-}
-
-func (jf jsonFile) AssembleFile(f *generator.File, pathname string) error {
-	destFile, err := os.Create(pathname)
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
-	b := &bytes.Buffer{}
-	et := generator.NewErrorTracker(b)
-	jf.Assemble(et, f)
-	if et.Error() != nil {
-		return et.Error()
-	}
-	var formatted []byte
-	if formatted, err = jf.Format(b.Bytes()); err != nil {
-		err = fmt.Errorf("unable to format file %q (%v)", pathname, err)
-		// Write the file anyway, so they can see what's going wrong and fix the generator.
-		if _, err2 := destFile.Write(b.Bytes()); err2 != nil {
-			return err2
-		}
-		return err
-	}
-	_, err = destFile.Write(formatted)
-	return err
+	generator.DefaultFileType
 }
 
-func (jf jsonFile) VerifyFile(f *generator.File, path string) error {
-	return nil
+func (jsonFile) NoVerify() bool {
+	return true
 }
 
 func catenate(str1, str2 string) string {
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// gengo-driver runs deepcopy-gen, defaulter-gen and set-gen over a single
+// parse of their inputs. Flags of the individual generators are prefixed by
+// their names, e.g. --deepcopy-bounding-dirs or --sets-output-package.
+package main
+
+import (
+	"k8s.io/gengo/args"
+	"k8s.io/gengo/driver"
+	deepcopy "k8s.io/gengo/examples/deepcopy-gen/generators"
+	defaulter "k8s.io/gengo/examples/defaulter-gen/generators"
+	sets "k8s.io/gengo/examples/set-gen/generators"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+func main() {
+	klog.InitFlags(nil)
+	r := &driver.Registry{}
+
+	deepcopyArgs := args.Default().WithoutDefaultFlagParsing()
+	deepcopyArgs.OutputFileBaseName = "deepcopy_generated"
+	deepcopyCustomArgs := &deepcopy.CustomArgs{}
+	deepcopyArgs.CustomArgs = deepcopyCustomArgs
+	register(r, &driver.Generator{
+		Name: "deepcopy",
+		Args: deepcopyArgs,
+		AddFlags: func(fs *pflag.FlagSet) {
+			fs.StringSliceVar(&deepcopyCustomArgs.BoundingDirs, "bounding-dirs", deepcopyCustomArgs.BoundingDirs,
+				"Comma-separated list of import paths which bound the types for which deep-copies will be generated.")
+		},
+		NameSystems:       deepcopy.NameSystems(),
+		DefaultNameSystem: deepcopy.DefaultNameSystem(),
+		Packages:          deepcopy.Packages,
+	})
+
+	defaulterArgs := args.Default().WithoutDefaultFlagParsing()
+	defaulterArgs.OutputFileBaseName = "defaulter_generated"
+	defaulterCustomArgs := &defaulter.CustomArgs{ExtraPeerDirs: []string{}}
+	defaulterArgs.CustomArgs = defaulterCustomArgs
+	register(r, &driver.Generator{
+		Name: "defaulter",
+		Args: defaulterArgs,
+		AddFlags: func(fs *pflag.FlagSet) {
+			fs.StringSliceVar(&defaulterCustomArgs.ExtraPeerDirs, "extra-peer-dirs", defaulterCustomArgs.ExtraPeerDirs,
+				"Comma-separated list of import paths which are considered, after tag-specified peers, for conversions.")
+		},
+		NameSystems:       defaulter.NameSystems(),
+		DefaultNameSystem: defaulter.DefaultNameSystem(),
+		Packages:          defaulter.Packages,
+	})
+
+	register(r, &driver.Generator{
+		Name:              "sets",
+		NameSystems:       sets.NameSystems(),
+		DefaultNameSystem: sets.DefaultNameSystem(),
+		Packages:          sets.Packages,
+	})
+
+	r.Main()
+}
+
+func register(r *driver.Registry, g *driver.Generator) {
+	if err := r.Register(g); err != nil {
+		klog.Fatalf("Error: %v", err)
+	}
+}
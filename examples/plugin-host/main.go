@@ -0,0 +1,120 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// plugin-host parses the input directories once, and runs each of the given
+// plugins (see k8s.io/gengo/plugin) against the result.
+//
+// Each --plugin is the path of a plugin executable, followed by the arguments
+// to send to it, e.g.:
+//
+//	plugin-host -i k8s.io/api/... -o out \
+//		--plugin "set-gen --output-package=k8s.io/sets" \
+//		--plugin "deepcopy-gen --bounding-dirs=k8s.io/api"
+package main
+
+import (
+	goflag "flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/gengo/args"
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/plugin"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+func main() {
+	klog.InitFlags(nil)
+	arguments := args.Default().WithoutDefaultFlagParsing()
+	plugins := []string{}
+	arguments.AddFlags(pflag.CommandLine)
+	pflag.CommandLine.StringArrayVar(&plugins, "plugin", plugins, "A plugin to run, followed by its arguments. May be repeated.")
+	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
+	pflag.Parse()
+
+	if err := run(arguments, plugins); err != nil {
+		klog.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	klog.V(2).Info("Completed successfully.")
+}
+
+func run(arguments *args.GeneratorArgs, plugins []string) error {
+	// Plugins name their own output, and generate whole files.
+	switch {
+	case arguments.OutputPackagePath != "" || arguments.OutputFileBaseName != "":
+		return fmt.Errorf("the output package and file base are set by each plugin's own arguments")
+	case arguments.ManifestFile != "":
+		return fmt.Errorf("--manifest is not supported by plugin-host")
+	case arguments.TypeCheck:
+		return fmt.Errorf("--type-check is not supported by plugin-host")
+	case arguments.ShardMaxTypes != 0 || arguments.ShardMaxBytes != 0:
+		return fmt.Errorf("--shard-max-types and --shard-max-bytes are not supported by plugin-host; pass them to the plugins instead")
+	}
+
+	b, err := arguments.NewBuilder()
+	if err != nil {
+		return fmt.Errorf("Failed making a parser: %v", err)
+	}
+	c, err := generator.NewContext(b, namer.NameSystems{}, "")
+	if err != nil {
+		return fmt.Errorf("Failed making a context: %v", err)
+	}
+	if err := arguments.ConfigureContext(c); err != nil {
+		return err
+	}
+	c.ParallelFiles = true
+	if arguments.CleanOrphans {
+		c.OrphanMarkers = arguments.OrphanMarkers()
+	}
+	archive, err := arguments.OpenOutputArchive(c)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, spec := range plugins {
+		fields := strings.Fields(spec)
+		if len(fields) == 0 {
+			continue
+		}
+		p := &plugin.Plugin{
+			Command:   fields[0],
+			Args:      fields[1:],
+			InputDirs: arguments.InputDirs,
+		}
+		if err := p.Execute(c, arguments.OutputBase); err != nil {
+			return err
+		}
+	}
+	// Orphans are only known once all the plugins have run.
+	if arguments.CleanOrphans {
+		err = c.RemoveOrphans(arguments.OutputBase)
+	}
+	if c.Verify {
+		if err := arguments.WriteVerifyOutputs(c); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return archive.Finish()
+}
@@ -84,7 +84,7 @@ func Packages(_ *generator.Context, arguments *args.GeneratorArgs) generator.Pac
 					},
 					outputPackage: arguments.OutputPackagePath,
 					typeToMatch:   t,
-					imports:       generator.NewImportTracker(),
+					imports:       c.NewImportTracker(),
 				})
 			}
 			return generators
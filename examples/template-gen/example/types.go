@@ -0,0 +1,32 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package example provides input types to template-gen, which renders
+// stringer.tmpl for the structs tagged with "+gen-stringer", as configured by
+// config.json.
+package example
+
+// +gen-stringer
+type Widget struct {
+	Name string
+}
+
+// Gadget is not tagged, so has no String method.
+type Gadget struct{}
+
+// Color is tagged, but is not a struct, so has no String method.
+// +gen-stringer
+type Color string
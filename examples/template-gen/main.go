@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// template-gen renders templates for the types selected by a configuration
+// file, so that simple generators need no Go code. See
+// generator.TemplateConfig for the format of the configuration, and the
+// example directory for an example:
+//
+//	template-gen --template-config example/config.json -i k8s.io/gengo/examples/template-gen/example
+package main
+
+import (
+	"os"
+
+	"k8s.io/gengo/args"
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/namer"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+func main() {
+	klog.InitFlags(nil)
+	arguments := args.Default()
+
+	// Custom args.
+	configPath := ""
+	pflag.CommandLine.StringVar(&configPath, "template-config", configPath, "The JSON file configuring the templates to render.")
+
+	// Run it.
+	if err := arguments.Execute(
+		namer.NameSystems{
+			"public": namer.NewPublicNamer(0),
+			"raw":    namer.NewRawNamer("", nil),
+		},
+		"public",
+		func(c *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+			config, err := generator.ReadTemplateConfig(configPath)
+			if err != nil {
+				klog.Fatalf("Failed loading the template configuration: %v", err)
+			}
+			boilerplate, err := arguments.LoadGoBoilerplate()
+			if err != nil {
+				klog.Fatalf("Failed loading boilerplate: %v", err)
+			}
+			packages, err := config.Packages(c, boilerplate)
+			if err != nil {
+				klog.Fatalf("Failed selecting the types to render: %v", err)
+			}
+			return packages
+		},
+	); err != nil {
+		klog.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	klog.V(2).Info("Completed successfully.")
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+// addFileMetadata adds the build constraints, comments and directives the
+// generator wants to the file, skipping those it already has.
+func addFileMetadata(c *Context, f *File, g Generator) error {
+	if bc, ok := g.(BuildConstraintsGenerator); ok {
+		for _, expr := range bc.BuildConstraints(c) {
+			if _, err := parseConstraint(expr); err != nil {
+				return fmt.Errorf("generator %q returned an invalid build constraint %q: %v", g.Name(), expr, err)
+			}
+			f.BuildConstraints = appendMissing(f.BuildConstraints, expr)
+		}
+	}
+	if fc, ok := g.(FileCommentsGenerator); ok {
+		for _, comment := range fc.FileComments(c) {
+			if strings.Contains(comment, "\n") {
+				return fmt.Errorf("generator %q returned a comment spanning several lines: %q", g.Name(), comment)
+			}
+			f.Comments = appendMissing(f.Comments, comment)
+		}
+	}
+	if fd, ok := g.(FileDirectivesGenerator); ok {
+		for _, directive := range fd.FileDirectives(c) {
+			directive = strings.TrimPrefix(directive, "//")
+			if directive == "" || strings.Contains(directive, "\n") || directive[0] == ' ' {
+				return fmt.Errorf("generator %q returned an invalid directive %q", g.Name(), directive)
+			}
+			if constraint.IsGoBuild("//" + directive) {
+				return fmt.Errorf("generator %q returned a build constraint as a directive: use BuildConstraints instead", g.Name())
+			}
+			f.Directives = appendMissing(f.Directives, directive)
+		}
+	}
+	return nil
+}
+
+func appendMissing(list []string, s string) []string {
+	for _, existing := range list {
+		if existing == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func parseConstraint(expr string) (constraint.Expr, error) {
+	return constraint.Parse("//go:build " + expr)
+}
+
+// buildConstraintLine returns the //go:build line requiring all the given
+// expressions, and those of any build constraint lines in 'header', together
+// with the header without them. (go/format would otherwise replace them with
+// the new line.) Invalid expressions are logged and ignored.
+func buildConstraintLine(header []byte, exprs []string) ([]byte, string) {
+	var x constraint.Expr
+	and := func(y constraint.Expr) {
+		if x == nil {
+			x = y
+		} else {
+			x = &constraint.AndExpr{X: x, Y: y}
+		}
+	}
+
+	rest := &bytes.Buffer{}
+	for _, line := range bytes.SplitAfter(header, []byte("\n")) {
+		trimmed := strings.TrimSpace(string(line))
+		if constraint.IsGoBuild(trimmed) || constraint.IsPlusBuild(trimmed) {
+			if y, err := constraint.Parse(trimmed); err == nil {
+				and(y)
+				continue
+			}
+		}
+		rest.Write(line)
+	}
+	for _, expr := range exprs {
+		y, err := parseConstraint(expr)
+		if err != nil {
+			klog.Errorf("Ignoring invalid build constraint %q: %v", expr, err)
+			continue
+		}
+		and(y)
+	}
+
+	// Removing the lines may leave leading blank lines.
+	header = bytes.TrimLeft(rest.Bytes(), "\n")
+	if x == nil {
+		return header, ""
+	}
+	return header, "//go:build " + x.String()
+}
+
+// commentText returns the text of a comment line, with a leading space if it
+// needs one.
+func commentText(c string) string {
+	c = strings.TrimPrefix(c, "//")
+	if c == "" || c[0] == ' ' || c[0] == '\t' {
+		return c
+	}
+	return " " + c
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Past this many cells, the lines which differ are not matched up any
+// further, and the diff simply replaces all of them.
+const maxDiffCells = 4 * 1024 * 1024
+
+type diffOp struct {
+	// ' ' for a line both sides have, '-' for a removed line, '+' for an
+	// added one.
+	kind byte
+	line string
+}
+
+// UnifiedDiff returns a unified diff (as produced by `diff -u`) which turns
+// 'old' into 'new', with 'context' lines of context around each change. It
+// returns "" if they are the same. An oldName of "/dev/null" marks the
+// creation of a file.
+func UnifiedDiff(oldName, newName string, old, new []byte, context int) string {
+	if bytes.Equal(old, new) {
+		return ""
+	}
+	if context < 0 {
+		context = 0
+	}
+	ops := diffLines(splitLines(old), splitLines(new))
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks(ops, context) {
+		writeHunk(b, ops, h[0], h[1])
+	}
+	return b.String()
+}
+
+// splitLines splits b into lines, each keeping its "\n" (the last one may not
+// have one).
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the operations which turn a into b, based on a longest
+// common subsequence of lines.
+func diffLines(a, b []string) []diffOp {
+	ops := []diffOp{}
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{' ', a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	am, bm := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if (len(am)+1)*(len(bm)+1) > maxDiffCells {
+		for _, l := range am {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range bm {
+			ops = append(ops, diffOp{'+', l})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of
+		// am[i:] and bm[j:].
+		lcs := make([][]int, len(am)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(bm)+1)
+		}
+		for i := len(am) - 1; i >= 0; i-- {
+			for j := len(bm) - 1; j >= 0; j-- {
+				switch {
+				case am[i] == bm[j]:
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				case lcs[i+1][j] >= lcs[i][j+1]:
+					lcs[i][j] = lcs[i+1][j]
+				default:
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(am) || j < len(bm) {
+			switch {
+			case i < len(am) && j < len(bm) && am[i] == bm[j]:
+				ops = append(ops, diffOp{' ', am[i]})
+				i++
+				j++
+			case j == len(bm) || (i < len(am) && lcs[i+1][j] >= lcs[i][j+1]):
+				ops = append(ops, diffOp{'-', am[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', bm[j]})
+				j++
+			}
+		}
+	}
+
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// hunks returns the [start, end) ranges of ops to print, each covering one or
+// more changes with their context.
+func hunks(ops []diffOp, context int) [][2]int {
+	out := [][2]int{}
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		start, end := i-context, i+1+context
+		if start < 0 {
+			start = 0
+		}
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if n := len(out); n > 0 && start <= out[n-1][1] {
+			out[n-1][1] = end
+			continue
+		}
+		out = append(out, [2]int{start, end})
+	}
+	return out
+}
+
+func writeHunk(b *bytes.Buffer, ops []diffOp, start, end int) {
+	// Count the lines of each side before and within the hunk.
+	oldBefore, newBefore := 0, 0
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			oldBefore++
+		}
+		if op.kind != '-' {
+			newBefore++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	// An empty range is numbered by the line before it.
+	oldStart, newStart := oldBefore, newBefore
+	if oldCount > 0 {
+		oldStart++
+	}
+	if newCount > 0 {
+		newStart++
+	}
+
+	fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, op := range ops[start:end] {
+		b.WriteByte(op.kind)
+		b.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// diffStat returns the number of lines added and removed by a diff returned by
+// UnifiedDiff.
+func diffStat(diff string) (added, removed int) {
+	lines := strings.Split(diff, "\n")
+	if len(lines) < 2 {
+		return 0, 0
+	}
+	// Skip the file names.
+	for _, l := range lines[2:] {
+		switch {
+		case strings.HasPrefix(l, "+"):
+			added++
+		case strings.HasPrefix(l, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"testing"
+
+	"k8s.io/gengo/generator"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	table := map[string]struct {
+		old, new string
+		context  int
+		expect   string
+	}{
+		"same": {
+			old:    "a\nb\n",
+			new:    "a\nb\n",
+			expect: "",
+		},
+		"created": {
+			old:    "",
+			new:    "a\nb\n",
+			expect: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		"changed": {
+			old:     "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:     "1\n2\n3\nx\n5\n6\n7\n8\n9\n",
+			context: 1,
+			expect:  "--- old\n+++ new\n@@ -3,3 +3,3 @@\n 3\n-4\n+x\n 5\n",
+		},
+		"two hunks": {
+			old:     "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:     "x\n2\n3\n4\n5\n6\n7\n8\ny\n",
+			context: 1,
+			expect:  "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -8,2 +8,2 @@\n 8\n-9\n+y\n",
+		},
+		"merged hunks": {
+			old:     "1\n2\n3\n4\n5\n",
+			new:     "x\n2\n3\ny\n5\n",
+			context: 1,
+			expect:  "--- old\n+++ new\n@@ -1,5 +1,5 @@\n-1\n+x\n 2\n 3\n-4\n+y\n 5\n",
+		},
+		"no newline": {
+			old:     "a\nb",
+			new:     "a\nb\n",
+			context: 3,
+			expect:  "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+	for name, tc := range table {
+		if e, a := tc.expect, generator.UnifiedDiff("old", "new", []byte(tc.old), []byte(tc.new), tc.context); e != a {
+			t.Errorf("%v: wanted:\n%s\ngot:\n%s", name, e, a)
+		}
+	}
+}
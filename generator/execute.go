@@ -18,12 +18,15 @@ package generator
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"golang.org/x/tools/imports"
 	"k8s.io/gengo/namer"
@@ -45,10 +48,69 @@ func errs2strings(errors []error) []string {
 // should be a physical path on disk, not an import path. e.g.:
 // /path/to/home/path/to/gopath/src/
 // Each package has its import path already, this will be appended to 'outDir'.
+//
+// If c.Parallelism is greater than one, up to that many packages are executed
+// at the same time; see Context for what that means for generators.
+//
+// If c.OrphanMarkers is set, files which are no longer generated are then
+// removed (or reported, when verifying); see RemoveOrphans.
 func (c *Context) ExecutePackages(outDir string, packages Packages) error {
-	var errors []error
+	return c.executePackages(outDir, packages)
+}
+
+// ExecutePackagesContext is like ExecutePackages, but stops once ctx is done.
+// Generation is checked for cancellation between packages, generators and
+// types, and the files of a package are only written once all of them have
+// been generated, so no package is left with a mix of old and new output. If
+// ctx is done, the returned error wraps ctx.Err(), so it can be recognized
+// with errors.Is.
+func (c *Context) ExecutePackagesContext(ctx context.Context, outDir string, packages Packages) error {
+	c2 := *c
+	c2.ctx = ctx
+	err := c2.executePackages(outDir, packages)
+	if err := c2.canceled(); err != nil {
+		return err
+	}
+	return err
+}
+
+// canceled returns an error if the context's ctx is done.
+func (c *Context) canceled() error {
+	if c.ctx == nil || c.ctx.Err() == nil {
+		return nil
+	}
+	return fmt.Errorf("generation stopped: %w", c.ctx.Err())
+}
+
+func (c *Context) executePackages(outDir string, packages Packages) error {
 	for _, p := range packages {
-		if err := c.ExecutePackage(outDir, p); err != nil {
+		c.results.addPackageDir(filepath.Join(outDir, p.Path()))
+	}
+	var results []error
+	if c.Parallelism > 1 && len(packages) > 1 {
+		shared := c.concurrent()
+		results = shared.forEach(len(packages), func(i int) error {
+			return shared.ExecutePackage(outDir, packages[i])
+		})
+	} else {
+		results = make([]error, len(packages))
+		for i, p := range packages {
+			results[i] = c.ExecutePackage(outDir, p)
+		}
+	}
+	var errors []error
+	for _, err := range results {
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+	// Files can only be known to be orphans if everything else was
+	// generated; verifying reports them either way.
+	if len(errors) == 0 || c.Verify {
+		if err := c.canceled(); err != nil {
+			return err
+		}
+		if err := c.RemoveOrphans(outDir); err != nil {
 			errors = append(errors, err)
 		}
 	}
@@ -63,70 +125,127 @@ type DefaultFileType struct {
 	Assemble func(io.Writer, *File)
 }
 
-func (ft DefaultFileType) AssembleFile(f *File, pathname string) error {
-	klog.V(2).Infof("Assembling file %q", pathname)
-	destFile, err := os.Create(pathname)
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
+// RenderFile implements FileRenderer.
+func (ft DefaultFileType) RenderFile(f *File) ([]byte, error) {
 	b := &bytes.Buffer{}
 	et := NewErrorTracker(b)
 	ft.Assemble(et, f)
 	if et.Error() != nil {
-		return et.Error()
+		return nil, et.Error()
+	}
+	formatted, err := ft.Format(b.Bytes())
+	if err != nil {
+		return b.Bytes(), err
+	}
+	return formatted, nil
+}
+
+func (ft DefaultFileType) AssembleFile(f *File, pathname string) error {
+	_, err := writeFile(DiskOutput{}, ft, f, pathname, "")
+	return err
+}
+
+func (ft DefaultFileType) VerifyFile(f *File, pathname string) error {
+	_, err := verifyFile(DiskOutput{}, ft, f, pathname, filepath.ToSlash(filepath.Join(f.PackagePath, f.Name)), DefaultDiffContext)
+	return err
+}
+
+// writeFile renders f and writes it to out, unless out already has exactly
+// that content. If 'marker' is set and the content has it, an existing file
+// without it is not overwritten; see checkOverwrite. It returns whether the
+// file was written.
+func writeFile(out Output, r FileRenderer, f *File, pathname, marker string) (bool, error) {
+	klog.V(2).Infof("Assembling file %q", pathname)
+	content, err := r.RenderFile(f)
+	if err != nil && content == nil {
+		return false, err
+	}
+	if err := checkOverwrite(out.ReadFile, pathname, content, marker); err != nil {
+		return false, err
 	}
-	if formatted, err := ft.Format(b.Bytes()); err != nil {
+	if err != nil {
 		err = fmt.Errorf("unable to format file %q (%v).", pathname, err)
 		// Write the file anyway, so they can see what's going wrong and fix the generator.
-		if _, err2 := destFile.Write(b.Bytes()); err2 != nil {
-			return err2
+		if err2 := out.WriteFile(pathname, content); err2 != nil {
+			return false, err2
 		}
-		return err
-	} else {
-		_, err = destFile.Write(formatted)
-		return err
+		return true, err
+	}
+	if existing, err := out.ReadFile(pathname); err == nil && bytes.Equal(existing, content) {
+		klog.V(2).Infof("File %q is unchanged", pathname)
+		return false, nil
 	}
+	return true, out.WriteFile(pathname, content)
 }
 
-func (ft DefaultFileType) VerifyFile(f *File, pathname string) error {
+// verifyFile renders f and compares it with what's in out. 'name' is the path
+// of the file relative to the output directory, which is used in diffs. The
+// result is nil if the file could not be compared at all, or if its file type
+// is not verified (see NoVerify).
+func verifyFile(out Output, r FileRenderer, f *File, pathname, name string, diffContext int) (*VerifyResult, error) {
+	if nv, ok := r.(NoVerify); ok && nv.NoVerify() {
+		klog.V(2).Infof("Not verifying file %q", pathname)
+		return nil, nil
+	}
 	klog.V(2).Infof("Verifying file %q", pathname)
 	friendlyName := filepath.Join(f.PackageName, f.Name)
-	b := &bytes.Buffer{}
-	et := NewErrorTracker(b)
-	ft.Assemble(et, f)
-	if et.Error() != nil {
-		return et.Error()
+	formatted, err := r.RenderFile(f)
+	if err != nil && formatted == nil {
+		return nil, err
 	}
-	formatted, err := ft.Format(b.Bytes())
 	if err != nil {
-		return fmt.Errorf("unable to format the output for %q: %v", friendlyName, err)
+		return nil, fmt.Errorf("unable to format the output for %q: %v", friendlyName, err)
 	}
-	existing, err := ioutil.ReadFile(pathname)
-	if err != nil {
-		return fmt.Errorf("unable to read file %q for comparison: %v", friendlyName, err)
+	result := &VerifyResult{
+		Path:       name,
+		Package:    f.PackagePath,
+		Generators: f.Generators,
+		Status:     VerifyUpToDate,
 	}
-	if bytes.Compare(formatted, existing) == 0 {
-		return nil
-	}
-	// Be nice and find the first place where they differ
-	i := 0
-	for i < len(formatted) && i < len(existing) && formatted[i] == existing[i] {
-		i++
+	existing, err := out.ReadFile(pathname)
+	if os.IsNotExist(err) {
+		result.Status = VerifyMissing
+		result.Diff = UnifiedDiff("/dev/null", "b/"+name, nil, formatted, diffContext)
+		result.LinesAdded, result.LinesRemoved = diffStat(result.Diff)
+		return result, fmt.Errorf("output for %q is missing", friendlyName)
 	}
-	eDiff, fDiff := existing[i:], formatted[i:]
-	if len(eDiff) > 100 {
-		eDiff = eDiff[:100]
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %q for comparison: %v", friendlyName, err)
 	}
-	if len(fDiff) > 100 {
-		fDiff = fDiff[:100]
+	if bytes.Equal(formatted, existing) {
+		return result, nil
 	}
-	return fmt.Errorf("output for %q differs; first existing/expected diff: \n  %q\n  %q", friendlyName, string(eDiff), string(fDiff))
+	result.Status = VerifyStale
+	result.Diff = UnifiedDiff("a/"+name, "b/"+name, existing, formatted, diffContext)
+	result.LinesAdded, result.LinesRemoved = diffStat(result.Diff)
+	return result, fmt.Errorf("output for %q differs:\n%s", friendlyName, result.Diff)
 }
 
 func assembleGolangFile(w io.Writer, f *File) {
-	w.Write(f.Header)
+	header := f.Header
+	if len(f.BuildConstraints) > 0 {
+		var line string
+		header, line = buildConstraintLine(f.Header, f.BuildConstraints)
+		if line != "" {
+			fmt.Fprintf(w, "%s\n\n", line)
+		}
+	}
+	w.Write(header)
+	if len(f.Comments) > 0 || len(f.Directives) > 0 {
+		if len(header) > 0 && !bytes.HasSuffix(header, []byte("\n\n")) {
+			fmt.Fprint(w, "\n")
+		}
+		for _, c := range f.Comments {
+			fmt.Fprintf(w, "//%s\n", commentText(c))
+		}
+		if len(f.Comments) > 0 && len(f.Directives) > 0 {
+			fmt.Fprint(w, "\n")
+		}
+		for _, d := range f.Directives {
+			fmt.Fprintf(w, "//%s\n", strings.TrimPrefix(d, "//"))
+		}
+		fmt.Fprint(w, "\n")
+	}
 	fmt.Fprintf(w, "package %v\n\n", f.PackageName)
 
 	if len(f.Imports) > 0 {
@@ -169,6 +288,16 @@ func NewGolangFile() *DefaultFileType {
 	}
 }
 
+// NewGolangFileWithDeclaredImports returns a file type of Go files which are
+// formatted with FormatGoSource instead of imports.Process: it is much faster,
+// but the generators have to declare all the imports they use.
+func NewGolangFileWithDeclaredImports() *DefaultFileType {
+	return &DefaultFileType{
+		Format:   FormatGoSource,
+		Assemble: assembleGolangFile,
+	}
+}
+
 // format should be one line only, and not end with \n.
 func addIndentHeaderComment(b *bytes.Buffer, format string, args ...interface{}) {
 	if b.Len() > 0 {
@@ -215,44 +344,131 @@ func (c *Context) addNameSystems(namers namer.NameSystems) *Context {
 func (c *Context) ExecutePackage(outDir string, p Package) error {
 	path := filepath.Join(outDir, p.Path())
 	klog.V(2).Infof("Processing package %q, disk location %q", p.Name(), path)
+	if err := c.canceled(); err != nil {
+		return err
+	}
+	packageContext := c.filteredBy(p.Filter)
+	generators := p.Generators(packageContext)
+
+	var recorded *ManifestOutput
+	var hashes map[string]string
+	if c.Manifest != nil {
+		recorded, hashes = c.manifestOutput(p, packageContext, generators)
+	}
+	if recorded != nil {
+		changes := c.manifestChanges(c.output(), outDir, recorded, hashes)
+		c.results.addManifestResult(ManifestResult{
+			Package:    p.Path(),
+			Generators: recorded.Generators,
+			Skipped:    len(changes) == 0,
+			Changes:    changes,
+		})
+		if len(changes) == 0 {
+			klog.V(2).Infof("Skipping package %q: its inputs have not changed", p.Path())
+			c.skipPackage(outDir, recorded)
+			return nil
+		}
+	}
+
+	files, err := c.generateFiles(p, packageContext, generators)
+	if err != nil {
+		return err
+	}
+	if c.TypeCheck {
+		if err := c.typeCheck(outDir, p, files); err != nil {
+			return err
+		}
+	}
+	if err := c.ExecuteFiles(outDir, files); err != nil {
+		return err
+	}
+	// When verifying, the files on disk weren't written by this run, so
+	// they may not be what the inputs generate.
+	if recorded != nil && !c.Verify {
+		c.recordPackage(c.output(), outDir, recorded, hashes, files)
+	}
+	return nil
+}
+
+// GeneratePackage runs the generators of a single package, without writing
+// anything. The returned files are in the order in which generators first
+// referred to them, and can be written with ExecuteFiles.
+func (c *Context) GeneratePackage(p Package) ([]*File, error) {
+	if err := c.canceled(); err != nil {
+		return nil, err
+	}
 	// Filter out any types the *package* doesn't care about.
 	packageContext := c.filteredBy(p.Filter)
-	os.MkdirAll(path, 0755)
-	files := map[string]*File{}
-	for _, g := range p.Generators(packageContext) {
-		// Filter out types the *generator* doesn't care about.
-		genContext := packageContext.filteredBy(g.Filter)
-		// Now add any extra name systems defined by this generator
-		genContext = genContext.addNameSystems(g.Namers(genContext))
+	return c.generateFiles(p, packageContext, p.Generators(packageContext))
+}
 
+// generateFiles runs the package's generators, with the context filtered by
+// the package.
+func (c *Context) generateFiles(p Package, packageContext *Context, generators []Generator) ([]*File, error) {
+	files := map[string]*File{}
+	ordered := []*File{}
+	// Which generator asked for each import line of each file.
+	importers := map[*File]map[string]string{}
+	for _, g := range generators {
+		if err := c.canceled(); err != nil {
+			return nil, err
+		}
 		fileType := g.FileType()
 		if len(fileType) == 0 {
-			return fmt.Errorf("generator %q must specify a file type", g.Name())
-		}
-		f := files[g.Filename()]
-		if f == nil {
-			// This is the first generator to reference this file, so start it.
-			f = &File{
-				Name:              g.Filename(),
-				FileType:          fileType,
-				PackageName:       p.Name(),
-				PackagePath:       p.Path(),
-				PackageSourcePath: p.SourcePath(),
-				Header:            p.Header(g.Filename()),
-				Imports:           map[string]struct{}{},
+			return nil, fmt.Errorf("generator %q must specify a file type", g.Name())
+		}
+		packageName, localPackage := p.Name(), p.Path()
+		if xt, ok := g.(ExternalTestGenerator); ok && xt.ExternalTest() {
+			if !strings.HasSuffix(g.Filename(), "_test.go") {
+				return nil, fmt.Errorf("generator %q writes to the external test package, but its file %q is not a test", g.Name(), g.Filename())
 			}
-			files[f.Name] = f
-		} else {
-			if f.FileType != g.FileType() {
-				return fmt.Errorf("file %q already has type %q, but generator %q wants to use type %q", f.Name, f.FileType, g.Name(), g.FileType())
+			packageName, localPackage = p.Name()+"_test", p.Path()+"_test"
+		}
+		// file returns the named file, starting it if this is the first
+		// generator to reference it.
+		file := func(name string) (*File, error) {
+			f := files[name]
+			if f == nil {
+				f = &File{
+					Name:              name,
+					FileType:          fileType,
+					PackageName:       packageName,
+					PackagePath:       p.Path(),
+					PackageSourcePath: p.SourcePath(),
+					Header:            p.Header(name),
+					Imports:           map[string]struct{}{},
+					ImportTracker:     newFileImportTracker(localPackage, c.ImportAliasPolicy),
+				}
+				files[f.Name] = f
+				ordered = append(ordered, f)
+				importers[f] = map[string]string{}
+			} else {
+				if f.FileType != fileType {
+					return nil, fmt.Errorf("file %q already has type %q, but generator %q wants to use type %q", f.Name, f.FileType, g.Name(), fileType)
+				}
+				if f.PackageName != packageName {
+					return nil, fmt.Errorf("file %q is in package %q, but generator %q wants to use package %q", f.Name, f.PackageName, g.Name(), packageName)
+				}
 			}
+			f.Generators = append(f.Generators, g.Name())
+			return f, nil
+		}
+		f, err := file(g.Filename())
+		if err != nil {
+			return nil, err
 		}
 
+		// Filter out types the *generator* doesn't care about.
+		genContext := packageContext.filteredBy(g.Filter)
+		genContext.file = f
+		// Now add any extra name systems defined by this generator
+		genContext = genContext.addNameSystems(g.Namers(genContext))
+
 		if vars := g.PackageVars(genContext); len(vars) > 0 {
 			addIndentHeaderComment(&f.Vars, "Package-wide variables from generator %q.", g.Name())
 			for _, v := range vars {
 				if _, err := fmt.Fprintf(&f.Vars, "%s\n", v); err != nil {
-					return err
+					return nil, err
 				}
 			}
 		}
@@ -260,55 +476,321 @@ func (c *Context) ExecutePackage(outDir string, p Package) error {
 			addIndentHeaderComment(&f.Consts, "Package-wide consts from generator %q.", g.Name())
 			for _, v := range consts {
 				if _, err := fmt.Fprintf(&f.Consts, "%s\n", v); err != nil {
-					return err
+					return nil, err
 				}
 			}
 		}
-		if err := genContext.executeBody(&f.Body, g); err != nil {
-			return err
+		written := []*File{f}
+		policy := genContext.shardPolicy(g)
+		if strings.HasSuffix(f.Name, ".go") && (policy != nil || c.Manifest.hadShards(p.Path(), f.Name)) {
+			// Even if it isn't sharded now, it was before, so the shards
+			// it no longer needs are removed.
+			f.ShardOf = f.Name
+		}
+		if policy != nil && f.ShardOf != "" {
+			// The shards share the first one's import tracker, which the
+			// generator's namers use; imports a shard doesn't need are
+			// removed when it is formatted.
+			shard := func(name string) (*File, error) {
+				s, err := file(name)
+				if err == nil {
+					s.ShardOf = f.Name
+				}
+				return s, err
+			}
+			if written, err = genContext.executeSharded(f, g, policy, shard); err != nil {
+				return nil, err
+			}
+		} else if err := genContext.executeBody(f, g); err != nil {
+			return nil, err
 		}
-		if imports := g.Imports(genContext); len(imports) > 0 {
+		imports := g.Imports(genContext)
+		for _, f := range written {
 			for _, i := range imports {
 				f.Imports[i] = struct{}{}
+				if _, found := importers[f][i]; !found {
+					importers[f][i] = g.Name()
+				}
+			}
+			if err := addFileMetadata(genContext, f, g); err != nil {
+				return nil, err
 			}
 		}
 	}
+	for _, f := range ordered {
+		trackers := []namer.ImportTracker{f.ImportTracker}
+		if first := files[f.ShardOf]; first != nil && first != f {
+			trackers = append(trackers, first.ImportTracker)
+		}
+		for _, t := range trackers {
+			for _, i := range t.ImportLines() {
+				f.Imports[i] = struct{}{}
+			}
+		}
+		normalizeImports(f, importers[f])
+		if err := checkImportNames(f, importers[f]); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
 
-	var errors []error
+// normalizeImports rewrites the file's import lines in a single form, so that
+// no package is imported twice just because it was spelled differently.
+func normalizeImports(f *File, importers map[string]string) {
+	normalized := map[string]struct{}{}
+	for i := range f.Imports {
+		name, path := parseImportLine(i)
+		line := path
+		if name != "" {
+			line = name + " \"" + path + "\""
+		}
+		normalized[line] = struct{}{}
+		if g, found := importers[i]; found {
+			importers[line] = g
+		}
+	}
+	f.Imports = normalized
+}
+
+// checkImportNames returns an error if the file imports different packages
+// with the same name, e.g. because two generators chose the same alias for
+// different packages. 'importers' says which generator asked for each import;
+// the others come from the file's import tracker.
+func checkImportNames(f *File, importers map[string]string) error {
+	lines := []string{}
+	for i := range f.Imports {
+		lines = append(lines, i)
+	}
+	sort.Strings(lines)
+	byName := map[string]string{}
+	for _, line := range lines {
+		name, path := parseImportLine(line)
+		if name == "" || name == "_" || name == "." {
+			continue
+		}
+		other, found := byName[name]
+		if !found {
+			byName[name] = line
+			continue
+		}
+		if _, otherPath := parseImportLine(other); otherPath != path {
+			return fmt.Errorf("file %q imports both %q (from %s) and %q (from %s) as %q", f.Name, otherPath, importerOf(importers, other), path, importerOf(importers, line), name)
+		}
+	}
+	return nil
+}
+
+func importerOf(importers map[string]string, line string) string {
+	if g, found := importers[line]; found {
+		return fmt.Sprintf("generator %q", g)
+	}
+	return "the file's import tracker"
+}
+
+// ExecuteFiles assembles (or, if c.Verify is set, verifies) the given files
+// with the file types registered in the context. Each file is placed in the
+// directory of its package under 'outDir'.
+func (c *Context) ExecuteFiles(outDir string, files []*File) error {
+	// Once writing starts, finish it, so that no package is left with only
+	// some of its files updated.
+	if err := c.canceled(); err != nil {
+		return err
+	}
+	packages := []string{}
+	seen := map[string]bool{}
 	for _, f := range files {
-		finalPath := filepath.Join(path, f.Name)
-		assembler, ok := c.FileTypes[f.FileType]
-		if !ok {
+		if !seen[f.PackagePath] {
+			seen[f.PackagePath] = true
+			packages = append(packages, f.PackagePath)
+		}
+		if _, ok := c.FileTypes[f.FileType]; !ok {
 			return fmt.Errorf("the file type %q registered for file %q does not exist in the context", f.FileType, f.Name)
 		}
-		var err error
+	}
+
+	out := c.output()
+	executeFile := func(i int) error {
+		f := files[i]
+		finalPath := filepath.Join(outDir, f.PackagePath, f.Name)
+		c.results.addGenerated(finalPath)
+		assembler := c.FileTypes[f.FileType]
+		if r, ok := assembler.(FileRenderer); ok {
+			var mapped *sourceMapRenderer
+			if c.SourceMap != SourceMapNone && strings.HasSuffix(f.Name, ".go") {
+				mapped = &sourceMapRenderer{FileRenderer: r, mode: c.SourceMap, dir: filepath.Dir(finalPath)}
+				r = mapped
+			}
+			err := c.renderFile(out, r, f, finalPath)
+			// When verifying, the source map is compared even if the
+			// file is stale.
+			if c.hasSourceMap(f) && mapped.sourceMap != nil && (err == nil || c.Verify) {
+				m := sourceMapOf(f)
+				mapPath := filepath.Join(outDir, m.PackagePath, m.Name)
+				c.results.addGenerated(mapPath)
+				if mapErr := c.renderFile(out, sourceMapFile{mapped.sourceMap}, m, mapPath); err == nil {
+					err = mapErr
+				}
+			}
+			return err
+		}
 		if c.Verify {
-			err = assembler.VerifyFile(f, finalPath)
-		} else {
-			err = assembler.AssembleFile(f, finalPath)
+			return assembler.VerifyFile(f, finalPath)
 		}
+		// The content of files of these types isn't known, so only Go
+		// files, which always carry the marker, are checked.
+		if strings.HasSuffix(f.Name, ".go") {
+			if err := checkOverwrite(ioutil.ReadFile, finalPath, nil, c.GeneratedMarker); err != nil {
+				return err
+			}
+		}
+		// File types which write files themselves expect the directory to
+		// exist.
+		os.MkdirAll(filepath.Dir(finalPath), 0755)
+		err := assembler.AssembleFile(f, finalPath)
+		if err == nil {
+			c.results.addWritten(true)
+		}
+		return err
+	}
+	var results []error
+	if c.ParallelFiles && c.Parallelism > 1 {
+		results = c.forEach(len(files), executeFile)
+	} else {
+		results = make([]error, len(files))
+		for i := range files {
+			results[i] = executeFile(i)
+		}
+	}
+
+	var errors []error
+	for _, err := range results {
 		if err != nil {
 			errors = append(errors, err)
 		}
 	}
+	if len(errors) == 0 || c.Verify {
+		if err := c.removeStaleShards(outDir, files); err != nil {
+			errors = append(errors, err)
+		}
+	}
 	if len(errors) > 0 {
-		return fmt.Errorf("errors in package %q:\n%v\n", p.Path(), strings.Join(errs2strings(errors), "\n"))
+		return fmt.Errorf("errors in package %q:\n%v\n", strings.Join(packages, ", "), strings.Join(errs2strings(errors), "\n"))
 	}
 	return nil
 }
 
-func (c *Context) executeBody(w io.Writer, generator Generator) error {
-	et := NewErrorTracker(w)
+// renderFile writes f, as rendered by r, to pathname in out, or verifies it.
+func (c *Context) renderFile(out Output, r FileRenderer, f *File, pathname string) error {
+	if c.Verify {
+		name := filepath.ToSlash(filepath.Join(f.PackagePath, f.Name))
+		result, err := verifyFile(out, r, f, pathname, name, c.DiffContext)
+		if result != nil {
+			c.results.addVerified(*result)
+		}
+		return err
+	}
+	written, err := writeFile(out, r, f, pathname, c.GeneratedMarker)
+	if err != nil {
+		return err
+	}
+	c.results.addWritten(written)
+	return nil
+}
+
+// output returns where the context writes files.
+func (c *Context) output() Output {
+	if c.Output == nil {
+		return DiskOutput{}
+	}
+	return c.Output
+}
+
+// checkOverwrite returns an error if there is a file at path which doesn't
+// have the marker, as long as the content about to replace it (if known) does:
+// file types which can't carry the marker, such as JSON, are not checked.
+func checkOverwrite(read func(string) ([]byte, error), path string, content []byte, marker string) error {
+	if marker == "" || (content != nil && !hasMarker(content, []string{marker})) {
+		return nil
+	}
+	existing, err := read(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read %q to check whether it was generated: %v", path, err)
+	}
+	if !hasMarker(existing, []string{marker}) {
+		return fmt.Errorf("refusing to overwrite %q: it does not have a %q comment, so it may have been written by hand; move it out of the way, or allow overwriting it", path, marker)
+	}
+	return nil
+}
+
+// concurrent returns a copy of the context which can be shared by concurrently
+// executing packages.
+func (c *Context) concurrent() *Context {
+	// Compute these once, rather than racing to do so lazily.
+	c.IncomingImports()
+	c.TransitiveIncomingImports()
+
+	c2 := *c
+	c2.Namers = namer.NameSystems{}
+	for name, n := range c.Namers {
+		c2.Namers[name] = namer.NewSynchronizedNamer(n)
+	}
+	return &c2
+}
+
+// forEach calls f(0) ... f(n-1), with up to c.Parallelism calls running at the
+// same time, and returns their results in order.
+func (c *Context) forEach(n int, f func(int) error) []error {
+	results := make([]error, n)
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < c.Parallelism && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+func (c *Context) executeBody(f *File, generator Generator) error {
+	et := NewErrorTracker(&f.Body)
+	// section records what the generator wrote since 'start'.
+	section := func(t *types.Type, start int) {
+		if end := f.Body.Len(); end > start {
+			f.Sections = append(f.Sections, Section{Generator: generator.Name(), Type: t, Start: start, End: end})
+		}
+	}
+	start := f.Body.Len()
 	if err := generator.Init(c, et); err != nil {
 		return err
 	}
+	section(nil, start)
 	for _, t := range c.Order {
+		if err := c.canceled(); err != nil {
+			return err
+		}
+		start := f.Body.Len()
 		if err := generator.GenerateType(c, t, et); err != nil {
 			return err
 		}
+		section(t, start)
 	}
+	start = f.Body.Len()
 	if err := generator.Finalize(c, et); err != nil {
 		return err
 	}
+	section(nil, start)
 	return et.Error()
 }
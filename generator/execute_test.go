@@ -0,0 +1,624 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/parser"
+	"k8s.io/gengo/types"
+)
+
+// namesGen declares a constant with the public name of every type.
+type namesGen struct {
+	generator.DefaultGen
+	fail bool
+}
+
+func (g *namesGen) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	if g.fail {
+		return fmt.Errorf("failed on %v", t)
+	}
+	_, err := fmt.Fprintf(w, "const %sName = %q\n", c.Namers["public"].Name(t), t.Name.Name)
+	return err
+}
+
+func testPackages() generator.Packages {
+	packages := generator.Packages{}
+	for i := 0; i < 20; i++ {
+		packages = append(packages, &generator.DefaultPackage{
+			PackageName: fmt.Sprintf("out%d", i),
+			PackagePath: fmt.Sprintf("out%d", i),
+			FilterFunc: func(c *generator.Context, t *types.Type) bool {
+				return t.Kind == types.Struct
+			},
+			GeneratorList: []generator.Generator{
+				&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "a"}, fail: i%7 == 3},
+				&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "b"}},
+			},
+		})
+	}
+	return packages
+}
+
+func readTree(t *testing.T, dir string) map[string]string {
+	out := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		out[path[len(dir):]] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestExecutePackagesConcurrently(t *testing.T) {
+	execute := func(parallelism int, parallelFiles bool) (map[string]string, error) {
+		c := construct(t, map[string]string{
+			"base/foo/foo.go": `
+package foo
+
+type Blah struct{}
+type Other struct{}
+`,
+		})
+		c.Parallelism = parallelism
+		c.ParallelFiles = parallelFiles
+		dir, err := ioutil.TempDir("", "gengo-execute")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		err = c.ExecutePackages(dir, testPackages())
+		return readTree(t, dir), err
+	}
+
+	serial, serialErr := execute(1, false)
+	if serialErr == nil {
+		t.Fatalf("expected an error")
+	}
+	if len(serial) != 34 {
+		t.Errorf("expected 34 files, got %d", len(serial))
+	}
+	for _, parallelFiles := range []bool{false, true} {
+		got, err := execute(4, parallelFiles)
+		if err == nil || err.Error() != serialErr.Error() {
+			t.Errorf("wanted error:\n%v\ngot:\n%v", serialErr, err)
+		}
+		if !reflect.DeepEqual(serial, got) {
+			t.Errorf("concurrent output differs:\n%v\n---\n%v", serial, got)
+		}
+	}
+}
+
+// cancelGen cancels generation when it sees its first type.
+type cancelGen struct {
+	generator.DefaultGen
+	cancel func()
+}
+
+func (g *cancelGen) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	g.cancel()
+	return nil
+}
+
+func TestExecutePackagesContext(t *testing.T) {
+	c := construct(t, map[string]string{
+		"base/foo/foo.go": `
+package foo
+
+type Blah struct{}
+type Other struct{}
+`,
+	})
+	dir, err := ioutil.TempDir("", "gengo-execute")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	packages := testPackages()[:2]
+	packages[0].(*generator.DefaultPackage).GeneratorList = append(packages[0].(*generator.DefaultPackage).GeneratorList,
+		&cancelGen{DefaultGen: generator.DefaultGen{OptionalName: "a"}, cancel: cancel})
+	err = c.ExecutePackagesContext(ctx, dir, packages)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancellation error, got %v", err)
+	}
+	if files := readTree(t, dir); len(files) != 0 {
+		t.Errorf("expected no files to be written, got %v", files)
+	}
+}
+
+// refsGen declares a variable of every type, naming them with the file's
+// import tracker.
+type refsGen struct {
+	generator.DefaultGen
+	prefix  string
+	imports []string
+}
+
+func (g *refsGen) Namers(c *generator.Context) namer.NameSystems {
+	return namer.NameSystems{"raw": namer.NewRawNamer("example.com/out", c.FileImports())}
+}
+
+func (g *refsGen) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	_, err := fmt.Fprintf(w, "var %s%s %s\n", g.prefix, t.Name.Name, c.Namers["raw"].Name(t))
+	return err
+}
+
+func (g *refsGen) Imports(c *generator.Context) []string {
+	return g.imports
+}
+
+func TestFileImports(t *testing.T) {
+	b := parser.New()
+	for _, pkg := range []string{"a", "b"} {
+		src := fmt.Sprintf("package foo\n\ntype %s struct{}\n", strings.ToUpper(pkg))
+		if err := b.AddFileForTest("example.com/"+pkg+"/foo", "/tmp/"+pkg+"/foo/foo.go", []byte(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := generator.NewContext(b, namer.NameSystems{"public": namer.NewPublicNamer(0)}, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := func(generators ...generator.Generator) generator.Packages {
+		return generator.Packages{&generator.DefaultPackage{
+			PackageName: "out",
+			PackagePath: "example.com/out",
+			FilterFunc: func(c *generator.Context, t *types.Type) bool {
+				return t.Kind == types.Struct
+			},
+			GeneratorList: generators,
+		}}
+	}
+
+	packages := pkg(
+		&refsGen{DefaultGen: generator.DefaultGen{OptionalName: "refs"}, prefix: "x"},
+		&refsGen{DefaultGen: generator.DefaultGen{OptionalName: "refs"}, prefix: "y", imports: []string{"fmt", `"fmt"`}},
+	)
+	files, err := c.GeneratePackage(packages[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	imports := map[string]struct{}{
+		"fmt":                      {},
+		`foo "example.com/a/foo"`:  {},
+		`bfoo "example.com/b/foo"`: {},
+	}
+	if len(files) != 1 || !reflect.DeepEqual(imports, files[0].Imports) {
+		t.Errorf("wanted imports %v, got %v", imports, files[0].Imports)
+	}
+
+	out := generator.NewMemoryOutput()
+	c.Output = out
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ := out.ReadFile("/out/example.com/out/refs.go")
+	expected := `package out
+
+import (
+	foo "example.com/a/foo"
+	bfoo "example.com/b/foo"
+)
+
+var xA foo.A
+var xB bfoo.B
+var yA foo.A
+var yB bfoo.B
+`
+	if e, a := expected, string(content); e != a {
+		t.Errorf("wanted:\n%s\ngot:\n%s", e, a)
+	}
+
+	err = c.ExecutePackages("/out", pkg(
+		&refsGen{DefaultGen: generator.DefaultGen{OptionalName: "refs"}, prefix: "x"},
+		&refsGen{DefaultGen: generator.DefaultGen{OptionalName: "refs"}, prefix: "y", imports: []string{`foo "example.com/c/foo"`}},
+	))
+	if err == nil || !strings.Contains(err.Error(), `imports both "example.com/a/foo" (from the file's import tracker) and "example.com/c/foo" (from generator "refs") as "foo"`) {
+		t.Errorf("expected an import collision error, got %v", err)
+	}
+}
+
+// brokenGen refers to an undefined identifier for one type.
+type brokenGen struct {
+	generator.DefaultGen
+	broken string
+	// The value of the other types, "0" if empty.
+	value string
+}
+
+func (g *brokenGen) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	value := g.value
+	if value == "" {
+		value = "0"
+	}
+	if t.Name.Name == g.broken {
+		value = "undefinedValue"
+	}
+	_, err := fmt.Fprintf(w, "var %sValue int = %s\n", t.Name.Name, value)
+	return err
+}
+
+func TestTypeCheck(t *testing.T) {
+	b := parser.New()
+	if err := b.AddFileForTest("example.com/in", "/tmp/in/in.go", []byte("package in\n\ntype A struct{}\n\ntype B struct{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := generator.NewContext(b, namer.NameSystems{"public": namer.NewPublicNamer(0)}, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Output = generator.NewMemoryOutput()
+	c.TypeCheck = true
+	packages := func(broken string) generator.Packages {
+		return generator.Packages{&generator.DefaultPackage{
+			PackageName: "out",
+			PackagePath: "example.com/out",
+			FilterFunc: func(c *generator.Context, t *types.Type) bool {
+				return t.Kind == types.Struct
+			},
+			GeneratorList: []generator.Generator{
+				&brokenGen{DefaultGen: generator.DefaultGen{OptionalName: "values"}, broken: broken},
+			},
+		}}
+	}
+
+	if err := c.ExecutePackages("/out", packages("")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = c.ExecutePackages("/out", packages("B"))
+	if err == nil {
+		t.Fatalf("expected a type error")
+	}
+	for _, s := range []string{"example.com/out/values.go:4:", "undefinedValue", `from generator "values" for type example.com/in.B`} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected the error to contain %q, got: %v", s, err)
+		}
+	}
+}
+
+func TestTypeCheckResolvingImports(t *testing.T) {
+	b := parser.New()
+	if err := b.AddFileForTest("example.com/in", "/tmp/in/in.go", []byte("package in\n\ntype A struct{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := generator.NewContext(b, namer.NameSystems{"public": namer.NewPublicNamer(0)}, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := generator.NewMemoryOutput()
+	c.Output = out
+	c.TypeCheck = true
+	// The generator doesn't declare that it uses "strings".
+	packages := generator.Packages{&generator.DefaultPackage{
+		PackageName: "out",
+		PackagePath: "example.com/out",
+		FilterFunc: func(c *generator.Context, t *types.Type) bool {
+			return t.Kind == types.Struct
+		},
+		GeneratorList: []generator.Generator{
+			&brokenGen{DefaultGen: generator.DefaultGen{OptionalName: "values"}, value: `len(strings.Repeat("a", 2))`},
+		},
+	}}
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ := out.ReadFile("/out/example.com/out/values.go")
+	if !strings.Contains(string(content), `import "strings"`) {
+		t.Errorf("expected the import to be added, got:\n%s", content)
+	}
+}
+
+// metadataGen adds build constraints, comments and directives to its file.
+type metadataGen struct {
+	generator.DefaultGen
+	constraints, comments, directives []string
+}
+
+func (g *metadataGen) BuildConstraints(*generator.Context) []string { return g.constraints }
+func (g *metadataGen) FileComments(*generator.Context) []string     { return g.comments }
+func (g *metadataGen) FileDirectives(*generator.Context) []string   { return g.directives }
+
+func TestFileMetadata(t *testing.T) {
+	b := parser.New()
+	if err := b.AddFileForTest("example.com/in", "/tmp/in/in.go", []byte("package in\n")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := generator.NewContext(b, namer.NameSystems{"public": namer.NewPublicNamer(0)}, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := generator.NewMemoryOutput()
+	c.Output = out
+	packages := func(generators ...generator.Generator) generator.Packages {
+		return generator.Packages{&generator.DefaultPackage{
+			PackageName:   "out",
+			PackagePath:   "example.com/out",
+			HeaderText:    []byte("// +build !ignore_autogenerated\n\n/*\nCopyright.\n*/\n\n"),
+			GeneratorList: generators,
+		}}
+	}
+
+	err = c.ExecutePackages("/out", packages(
+		&metadataGen{
+			DefaultGen:  generator.DefaultGen{OptionalName: "a", OptionalBody: []byte("var A = 1\n")},
+			constraints: []string{"linux || darwin"},
+			comments:    []string{"Regenerate with hack/update.sh."},
+			directives:  []string{"go:generate echo a"},
+		},
+		&metadataGen{
+			DefaultGen:  generator.DefaultGen{OptionalName: "a", OptionalBody: []byte("var B = 2\n")},
+			constraints: []string{"!race", "linux || darwin"},
+			directives:  []string{"//go:generate echo b"},
+		},
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := out.ReadFile("/out/example.com/out/a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `//go:build !ignore_autogenerated && (linux || darwin) && !race
+
+/*
+Copyright.
+*/
+
+// Regenerate with hack/update.sh.
+
+//go:generate echo a
+//go:generate echo b
+
+package out
+
+var A = 1
+var B = 2
+`
+	if a := string(content); e != a {
+		t.Errorf("wanted:\n%s\ngot:\n%s", e, a)
+	}
+
+	for _, g := range []*metadataGen{
+		{DefaultGen: generator.DefaultGen{OptionalName: "bad"}, constraints: []string{"linux &&"}},
+		{DefaultGen: generator.DefaultGen{OptionalName: "bad"}, directives: []string{"go:build linux"}},
+		{DefaultGen: generator.DefaultGen{OptionalName: "bad"}, comments: []string{"two\nlines"}},
+	} {
+		if err := c.ExecutePackages("/out", packages(g)); err == nil || !strings.Contains(err.Error(), `generator "bad"`) {
+			t.Errorf("expected an error for %+v, got %v", g, err)
+		}
+	}
+}
+
+// xtestGen declares an example of every type in the external test package.
+type xtestGen struct {
+	generator.DefaultGen
+}
+
+func (g *xtestGen) ExternalTest() bool { return true }
+
+func (g *xtestGen) Namers(c *generator.Context) namer.NameSystems {
+	return namer.NameSystems{"raw": namer.NewRawNamer("example.com/in_test", c.FileImports())}
+}
+
+func (g *xtestGen) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	_, err := fmt.Fprintf(w, "func Example%s() {\n\t_ = %s{}\n}\n", t.Name.Name, c.Namers["raw"].Name(t))
+	return err
+}
+
+type brokenXTestGen struct {
+	brokenGen
+}
+
+func (g *brokenXTestGen) ExternalTest() bool { return true }
+
+func TestExternalTestPackage(t *testing.T) {
+	b := parser.New()
+	if err := b.AddFileForTest("example.com/in", "/tmp/in/in.go", []byte("package in\n\ntype A struct{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := generator.NewContext(b, namer.NameSystems{"public": namer.NewPublicNamer(0)}, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := generator.NewMemoryOutput()
+	c.Output = out
+	c.TypeCheck = true
+	packages := func(generators ...generator.Generator) generator.Packages {
+		return generator.Packages{&generator.DefaultPackage{
+			PackageName: "in",
+			PackagePath: "example.com/in",
+			FilterFunc: func(c *generator.Context, t *types.Type) bool {
+				return t.Kind == types.Struct
+			},
+			GeneratorList: generators,
+		}}
+	}
+
+	err = c.ExecutePackages("/out", packages(
+		&xtestGen{DefaultGen: generator.DefaultGen{OptionalName: "example_test"}},
+		&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "names"}},
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ := out.ReadFile("/out/example.com/in/example_test.go")
+	e := "package in_test\n\nimport (\n\tin \"example.com/in\"\n)\n\nfunc ExampleA() {\n\t_ = in.A{}\n}\n"
+	if a := string(content); e != a {
+		t.Errorf("wanted:\n%s\ngot:\n%s", e, a)
+	}
+	content, _ = out.ReadFile("/out/example.com/in/names.go")
+	if !strings.HasPrefix(string(content), "package in\n") {
+		t.Errorf("expected the package's own file to be in package in, got:\n%s", content)
+	}
+
+	c.Verify = true
+	if err := c.ExecutePackages("/out", packages(&xtestGen{DefaultGen: generator.DefaultGen{OptionalName: "example_test"}})); err != nil {
+		t.Errorf("unexpected verification error: %v", err)
+	}
+	c.Verify = false
+
+	broken := &brokenXTestGen{brokenGen{DefaultGen: generator.DefaultGen{OptionalName: "broken_test"}, broken: "A"}}
+	if err := c.ExecutePackages("/out", packages(broken)); err == nil || !strings.Contains(err.Error(), "example.com/in/broken_test.go:") {
+		t.Errorf("expected a type error in the external test, got %v", err)
+	}
+
+	for _, generators := range [][]generator.Generator{
+		{&xtestGen{DefaultGen: generator.DefaultGen{OptionalName: "example"}}},
+		{
+			&xtestGen{DefaultGen: generator.DefaultGen{OptionalName: "example_test"}},
+			&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "example_test"}},
+		},
+	} {
+		if err := c.ExecutePackages("/out", packages(generators...)); err == nil {
+			t.Errorf("expected an error for %v", generators)
+		}
+	}
+}
+
+// unverifiedFile is a file type whose files are not verified.
+type unverifiedFile struct {
+	generator.DefaultFileType
+}
+
+func (unverifiedFile) NoVerify() bool { return true }
+
+func TestNoVerify(t *testing.T) {
+	out := generator.NewMemoryOutput()
+	run := func(verify bool) (*generator.Context, error) {
+		c, packages := executeTestContext(t)
+		c.Output = out
+		c.Verify = verify
+		c.FileTypes["json"] = unverifiedFile{generator.DefaultFileType{
+			Format:   func(b []byte) ([]byte, error) { return b, nil },
+			Assemble: func(w io.Writer, f *generator.File) { w.Write(f.Body.Bytes()) },
+		}}
+		packages[0].(*generator.DefaultPackage).GeneratorList = []generator.Generator{&jsonGen{}}
+		return c, c.ExecutePackages("/out", packages)
+	}
+
+	if _, err := run(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := []string{"/out/example.com/out/names.json"}, out.Files(); !reflect.DeepEqual(e, a) {
+		t.Fatalf("wanted files %v, got %v", e, a)
+	}
+
+	out.WriteFile("/out/example.com/out/names.json", []byte("\"Edited\"\n"))
+	c, err := run(true)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if results := c.VerifyResults(); len(results) != 0 {
+		t.Errorf("expected the file not to be verified, got %+v", results)
+	}
+}
+
+// executeTestContext returns a context with a single type, and a package
+// which generates example.com/out/names.go from it.
+func executeTestContext(t *testing.T) (*generator.Context, generator.Packages) {
+	c := construct(t, map[string]string{"base/foo/foo.go": "package foo\n\ntype Blah struct{}\n"})
+	packages := generator.Packages{&generator.DefaultPackage{
+		PackageName:   "out",
+		PackagePath:   "example.com/out",
+		GeneratorList: []generator.Generator{&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "names"}}},
+	}}
+	return c, packages
+}
+
+func TestRefuseToOverwriteHandWritten(t *testing.T) {
+	path := "/out/example.com/out/names.go"
+	handWritten := "package out\n\n// BlahName is important.\nconst BlahName = \"Foo\"\n"
+	out := generator.NewMemoryOutput()
+	out.WriteFile(path, []byte(handWritten))
+
+	c, packages := executeTestContext(t)
+	packages[0].(*generator.DefaultPackage).HeaderText = []byte("// Code generated by test. DO NOT EDIT.\n\n")
+	c.Output = out
+	c.GeneratedMarker = "// Code generated by"
+	err := c.ExecutePackages("/out", packages)
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Fatalf("expected an error naming %q, got %v", path, err)
+	}
+	if content, _ := out.ReadFile(path); string(content) != handWritten {
+		t.Errorf("the hand-written file was overwritten:\n%s", content)
+	}
+
+	out.WriteFile(path, []byte("// Code generated by test. DO NOT EDIT.\n\npackage out\n"))
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Errorf("unexpected error overwriting a generated file: %v", err)
+	}
+
+	out.WriteFile(path, []byte(handWritten))
+	c.GeneratedMarker = ""
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Errorf("unexpected error without a marker: %v", err)
+	}
+}
+
+// jsonGen writes the names of its types to a JSON file.
+type jsonGen struct {
+	generator.DefaultGen
+}
+
+func (g *jsonGen) Filename() string { return "names.json" }
+func (g *jsonGen) FileType() string { return "json" }
+
+func (g *jsonGen) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%q\n", t.Name.Name)
+	return err
+}
+
+func TestOverwriteWithoutMarker(t *testing.T) {
+	out := generator.NewMemoryOutput()
+	for i := 0; i < 2; i++ {
+		c, packages := executeTestContext(t)
+		c.Output = out
+		c.GeneratedMarker = "// Code generated by"
+		c.FileTypes["json"] = generator.DefaultFileType{
+			Format:   func(b []byte) ([]byte, error) { return b, nil },
+			Assemble: func(w io.Writer, f *generator.File) { w.Write(f.Body.Bytes()) },
+		}
+		packages[0].(*generator.DefaultPackage).GeneratorList = []generator.Generator{&jsonGen{}}
+		if err := c.ExecutePackages("/out", packages); err != nil {
+			t.Fatalf("run %d: unexpected error: %v", i, err)
+		}
+	}
+	if content, _ := out.ReadFile("/out/example.com/out/names.json"); string(content) != "\"Blah\"\n" {
+		t.Errorf("unexpected content: %q", content)
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FormatGoSource formats Go source: it removes the imports which are not used,
+// groups the others (standard library first), keeping their comments, and runs
+// go/format. Unlike imports.Process, it never looks for packages on disk, so it
+// is fast, but it doesn't add missing imports: generators must declare all the
+// imports they need, e.g. with the file's import tracker. See
+// NewGolangFileWithDeclaredImports.
+//
+// An import without an explicit name is considered used if either its last
+// path element or the name goimports would assume for it (e.g. "yaml" for
+// "gopkg.in/yaml.v2") is used.
+func FormatGoSource(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var decls []*ast.GenDecl
+	for _, d := range file.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			decls = append(decls, gd)
+		}
+	}
+	if len(decls) == 0 {
+		return format.Source(src)
+	}
+
+	used := usedPackageNames(fset, file)
+	std, other := []importLine{}, []importLine{}
+	seen := map[string]bool{}
+	for _, d := range decls {
+		for _, s := range d.Specs {
+			spec := s.(*ast.ImportSpec)
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+			line := spec.Path.Value
+			if spec.Name != nil {
+				line = spec.Name.Name + " " + line
+			}
+			if seen[line] || !importUsed(spec, importPath, used) {
+				continue
+			}
+			seen[line] = true
+			l := importLine{line: line, doc: spec.Doc, comment: spec.Comment}
+			if isStandardImport(importPath) {
+				std = append(std, l)
+			} else {
+				other = append(other, l)
+			}
+		}
+	}
+	sort.Slice(std, func(i, j int) bool { return std[i].line < std[j].line })
+	sort.Slice(other, func(i, j int) bool { return other[i].line < other[j].line })
+
+	// Replace the import declarations with a single one.
+	block := &bytes.Buffer{}
+	if len(std)+len(other) > 0 {
+		block.WriteString("import (\n")
+		for _, l := range std {
+			l.write(block)
+		}
+		if len(std) > 0 && len(other) > 0 {
+			block.WriteString("\n")
+		}
+		for _, l := range other {
+			l.write(block)
+		}
+		block.WriteString(")\n")
+	}
+	out := &bytes.Buffer{}
+	last := 0
+	for i, d := range decls {
+		start, end := fset.Position(d.Pos()).Offset, fset.Position(d.End()).Offset
+		out.Write(src[last:start])
+		if i == 0 {
+			out.Write(block.Bytes())
+		}
+		last = end
+	}
+	out.Write(src[last:])
+	return format.Source(out.Bytes())
+}
+
+// importLine is an import spec in the import block FormatGoSource writes.
+type importLine struct {
+	// The name, if any, and the quoted path.
+	line string
+	// The comments above and after the spec.
+	doc, comment *ast.CommentGroup
+}
+
+func (l importLine) write(b *bytes.Buffer) {
+	if l.doc != nil {
+		for _, c := range l.doc.List {
+			fmt.Fprintf(b, "\t%s\n", c.Text)
+		}
+	}
+	fmt.Fprintf(b, "\t%s", l.line)
+	if l.comment != nil {
+		for _, c := range l.comment.List {
+			fmt.Fprintf(b, " %s", c.Text)
+		}
+	}
+	b.WriteString("\n")
+}
+
+// usedPackageNames returns the names used to qualify identifiers in the file,
+// i.e. the "pkg" of "pkg.Name" where pkg is either an imported package or not
+// declared at all.
+//
+// The file is type-checked without looking at the imported packages, which are
+// assumed to be named as goimports would (see assumedPackageName), so that
+// local declarations shadowing a package name are taken into account. Type
+// errors, e.g. about the missing declarations of the imported packages, are
+// ignored.
+func usedPackageNames(fset *token.FileSet, file *ast.File) map[string]bool {
+	info := &types.Info{Uses: map[*ast.Ident]types.Object{}}
+	conf := types.Config{
+		Importer: importerFunc(func(importPath string) (*types.Package, error) {
+			pkg := types.NewPackage(importPath, assumedPackageName(importPath))
+			pkg.MarkComplete()
+			return pkg, nil
+		}),
+		Error: func(error) {},
+	}
+	conf.Check(file.Name.Name, fset, []*ast.File{file}, info)
+
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				switch obj := info.Uses[id]; obj.(type) {
+				case nil, *types.PkgName:
+					used[id.Name] = true
+				}
+			}
+		}
+		return true
+	})
+	return used
+}
+
+type importerFunc func(importPath string) (*types.Package, error)
+
+func (f importerFunc) Import(importPath string) (*types.Package, error) {
+	return f(importPath)
+}
+
+func importUsed(spec *ast.ImportSpec, importPath string, used map[string]bool) bool {
+	if spec.Name != nil {
+		name := spec.Name.Name
+		return name == "_" || name == "." || used[name]
+	}
+	return used[path.Base(importPath)] || used[assumedPackageName(importPath)]
+}
+
+// assumedPackageName returns the name of the package at importPath as
+// goimports would guess it, without looking at the package.
+func assumedPackageName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil {
+			if dir := path.Dir(importPath); dir != "." {
+				base = path.Base(dir)
+			}
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// isStandardImport returns whether importPath looks like a standard library
+// package, i.e. its first element has no dot.
+func isStandardImport(importPath string) bool {
+	first := strings.SplitN(importPath, "/", 2)[0]
+	return !strings.Contains(first, ".")
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"testing"
+
+	"k8s.io/gengo/generator"
+)
+
+func TestFormatGoSource(t *testing.T) {
+	table := map[string]struct {
+		src, expect string
+	}{
+		"unused imports": {
+			src: `package out
+import (
+	"sort"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"fmt"
+	"k8s.io/api/apps/v1beta1"
+	"gopkg.in/yaml.v2"
+	"github.com/foo/go-bar"
+	_ "example.com/plugin"
+	"strings"
+)
+import "fmt"
+var _ = fmt.Sprintf
+var _ v1.Pod
+var _ v1beta1.Deployment
+var _ = yaml.Marshal
+var _ = bar.Baz
+func f(sort int) int { return sort.X }
+`,
+			expect: `package out
+
+import (
+	"fmt"
+
+	_ "example.com/plugin"
+	"github.com/foo/go-bar"
+	"gopkg.in/yaml.v2"
+	"k8s.io/api/apps/v1beta1"
+	v1 "k8s.io/api/core/v1"
+)
+
+var _ = fmt.Sprintf
+var _ v1.Pod
+var _ v1beta1.Deployment
+var _ = yaml.Marshal
+var _ = bar.Baz
+
+func f(sort int) int { return sort.X }
+`,
+		},
+		"comments": {
+			src: `package out
+// The imports.
+import (
+	// Marshalling.
+	"encoding/json"
+	"fmt" // Printing.
+	"strings" // Unused.
+)
+var _ = json.Marshal
+var _ = fmt.Sprintf
+`,
+			expect: `package out
+
+// The imports.
+import (
+	// Marshalling.
+	"encoding/json"
+	"fmt" // Printing.
+)
+
+var _ = json.Marshal
+var _ = fmt.Sprintf
+`,
+		},
+		"shadowed": {
+			src: `package out
+import (
+	"fmt"
+	"strings"
+)
+type builder struct{}
+func (strings builder) Join() string { return fmt.Sprint(strings.Join) }
+`,
+			expect: `package out
+
+import (
+	"fmt"
+)
+
+type builder struct{}
+
+func (strings builder) Join() string { return fmt.Sprint(strings.Join) }
+`,
+		},
+		"all unused": {
+			src:    "package out\n\nimport \"fmt\"\n\nconst x = 1\n",
+			expect: "package out\n\nconst x = 1\n",
+		},
+		"no imports": {
+			src:    "package out\nconst x = 1\n",
+			expect: "package out\n\nconst x = 1\n",
+		},
+	}
+	for name, tc := range table {
+		out, err := generator.FormatGoSource([]byte(tc.src))
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", name, err)
+			continue
+		}
+		if e, a := tc.expect, string(out); e != a {
+			t.Errorf("%v: wanted:\n%s\ngot:\n%s", name, e, a)
+		}
+	}
+	if _, err := generator.FormatGoSource([]byte("package out\nfunc {")); err == nil {
+		t.Errorf("expected an error for invalid source")
+	}
+}
@@ -18,6 +18,8 @@ package generator
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 
 	"k8s.io/gengo/namer"
@@ -62,6 +64,60 @@ type File struct {
 	Vars              bytes.Buffer
 	Consts            bytes.Buffer
 	Body              bytes.Buffer
+
+	// The names of the generators which wrote to this file, in order.
+	Generators []string
+
+	// Tracks the imports needed by the generators which use it; its import
+	// lines are added to Imports once all the generators have run. See
+	// Context.FileImports.
+	ImportTracker namer.ImportTracker
+
+	// Which generator, and for which type, wrote each part of Body, in
+	// order.
+	Sections []Section
+
+	// Build constraint expressions, e.g. "linux && !race", which must all
+	// hold for the file to be built. Go files with constraints get a single
+	// //go:build line, which also includes any constraints in Header.
+	BuildConstraints []string
+
+	// Lines of comment placed after the header, without the leading "//".
+	// They are separated from the package clause, so they don't become part
+	// of the package's documentation.
+	Comments []string
+
+	// Directives placed after the comments, without the leading "//", e.g.
+	// "go:generate stringer -type=Kind".
+	Directives []string
+
+	// The name of the first shard of the generator's output this file
+	// belongs to, i.e. the generator's Filename, for the Go files of
+	// generators whose output is sharded, or was according to the
+	// context's Manifest. See ShardPolicy.
+	ShardOf string
+}
+
+// Section is a part of the body of a file written by a single call to a
+// generator.
+type Section struct {
+	// The name of the generator.
+	Generator string
+	// The type passed to GenerateType, or nil for Init and Finalize.
+	Type *types.Type
+	// The byte range of the section in the file's Body.
+	Start, End int
+}
+
+// SectionAt returns the section covering the given offset in the file's Body,
+// or nil.
+func (f *File) SectionAt(offset int) *Section {
+	for i := range f.Sections {
+		if s := &f.Sections[i]; s.Start <= offset && offset < s.End {
+			return s
+		}
+	}
+	return nil
 }
 
 type FileType interface {
@@ -140,10 +196,11 @@ type Generator interface {
 	Imports(*Context) []string
 
 	// Preferred file name of this generator, not including a path. It is
-	// allowed for multiple generators to use the same filename, but it's
-	// up to you to make sure they don't have colliding import names.
-	// TODO: provide per-file import tracking, removing the requirement
-	// that generators coordinate..
+	// allowed for multiple generators to use the same filename. Generators
+	// which track their imports with the file's tracker (see
+	// Context.FileImports) get consistent names for the packages they share;
+	// otherwise, it's up to you to make sure they don't have colliding
+	// import names.
 	Filename() string
 
 	// A registered file type in the context to generate this file with. If
@@ -151,7 +208,58 @@ type Generator interface {
 	FileType() string
 }
 
+// ExternalTestGenerator is implemented by generators which can write to the
+// external test package of the package they generate, i.e. to package
+// <name>_test, for black-box tests and examples. The generator's file name must
+// end in "_test.go". References to the package's own types are qualified, and
+// imported by the file's import tracker (see Context.FileImports).
+type ExternalTestGenerator interface {
+	// ExternalTest returns true if the generator writes to the external
+	// test package.
+	ExternalTest() bool
+}
+
+// BuildConstraintsGenerator is implemented by generators which restrict when
+// the files they write to are built. The constraints of all the generators
+// writing to a file are combined; see File.BuildConstraints. It is called
+// after Imports.
+type BuildConstraintsGenerator interface {
+	BuildConstraints(*Context) []string
+}
+
+// FileCommentsGenerator is implemented by generators which add comments to the
+// top of the files they write to; see File.Comments. It is called after
+// Imports.
+type FileCommentsGenerator interface {
+	FileComments(*Context) []string
+}
+
+// FileDirectivesGenerator is implemented by generators which add directives to
+// the top of the files they write to; see File.Directives. It is called after
+// Imports.
+type FileDirectivesGenerator interface {
+	FileDirectives(*Context) []string
+}
+
 // Context is global context for individual generators to consume.
+//
+// If Parallelism is greater than one, packages are executed concurrently, and
+// the generators of different packages share the context. In that case:
+//
+//   - Namers are wrapped so that they can be called concurrently. Namers
+//     returned by a generator's Namers method are only used by that
+//     generator, and need not be safe for concurrent use unless the
+//     generator itself is shared between packages.
+//   - Universe, Inputs and Order may be read, but not modified. Note that
+//     Universe.Type and Universe.Package add the type or package if it
+//     doesn't exist yet; only use them to look up things which are known to
+//     exist, or check for them with the map first.
+//   - IncomingImports and TransitiveIncomingImports are computed before any
+//     package runs, and are safe to call.
+//   - AddDir and AddDirectory must not be called.
+//   - FileTypes are shared by all packages (and, with ParallelFiles, all
+//     files), so their methods must be safe for concurrent use. The
+//     DefaultFileType ones are.
 type Context struct {
 	// A map from the naming system to the names for that system. E.g., you
 	// might have public names and several private naming systems.
@@ -181,8 +289,93 @@ type Context struct {
 	// correct. (You may set this after calling NewContext.)
 	Verify bool
 
+	// Where generated files are written, and verified against. Defaults to
+	// the disk. Only file types implementing FileRenderer use it (all the
+	// ones in this package do); others write files themselves. (You may
+	// set this after calling NewContext.)
+	Output Output
+
+	// If set, decides the names packages are imported with by the file
+	// import trackers (see FileImports) and those made by NewImportTracker.
+	// (You may set this after calling NewContext.)
+	ImportAliasPolicy *namer.ImportAliasPolicy
+
+	// If set, the output of generators writing Go files is split across
+	// several files when it gets too large, unless they implement
+	// ShardedGenerator. (You may set this after calling NewContext.)
+	Sharding *ShardPolicy
+
+	// How generated Go files are mapped back to the generators and input
+	// types which produced them, if at all. Only file types implementing
+	// FileRenderer support this. (You may set this after calling
+	// NewContext.)
+	SourceMap SourceMapMode
+
+	// If true, the Go files of each package are type-checked along with the
+	// package's existing sources before being written, and the package
+	// fails if they don't compile. This needs a context made from a parser.
+	// (You may set this after calling NewContext.)
+	TypeCheck bool
+
+	// If set, existing files are only overwritten if they have this string
+	// in their leading comments, e.g. "// Code generated by", so that files
+	// written by hand are never lost. Writing a file which doesn't have it
+	// fails instead. Files whose new content doesn't have the marker either,
+	// e.g. JSON files, are always overwritten. (You may set this after
+	// calling NewContext.)
+	GeneratedMarker string
+
+	// If set, files in the output directories which have any of these
+	// strings in their leading comments, e.g. the generator's build tag or
+	// "Code generated by" line, but which are no longer generated, are
+	// orphans: ExecutePackages removes them, or reports them when verifying.
+	// The markers must only identify files written by these packages. See
+	// RemoveOrphans.
+	OrphanMarkers []string
+
+	// If set, packages whose inputs and outputs haven't changed since they
+	// were recorded in the manifest are skipped, and the others are
+	// recorded once written (but not when verifying). See ManifestResults
+	// for what was skipped.
+	// (You may set this after calling NewContext.)
+	Manifest *Manifest
+
+	// Identifies the generator's code (e.g. a version or a hash of the
+	// binary), so that the manifest knows when outputs need to be generated
+	// again even if their inputs haven't changed.
+	GeneratorVersion string
+
+	// Describes the settings the generators were run with (e.g. their
+	// flags), so that the manifest knows when outputs need to be generated
+	// again because the settings changed.
+	GeneratorSettings string
+
+	// The number of lines of context around each change in the diffs of
+	// stale files produced when verifying.
+	DiffContext int
+
+	// The maximum number of packages to execute at the same time. Values
+	// less than two execute packages one after the other. The output and
+	// any errors are the same either way. (You may set this after calling
+	// NewContext.)
+	Parallelism int
+
+	// If true, and Parallelism is greater than one, the files of a single
+	// package are also assembled or verified concurrently.
+	ParallelFiles bool
+
 	// Allows generators to add packages at runtime.
 	builder *parser.Builder
+
+	// Set by ExecutePackagesContext; generation stops once it is done.
+	ctx context.Context
+
+	// The file being generated, in the context passed to a generator.
+	file *File
+
+	// What Execute* calls have done; shared by all contexts derived from
+	// this one.
+	results *executionResults
 }
 
 // NewContext generates a context from the given builder, naming systems, and
@@ -193,26 +386,87 @@ func NewContext(b *parser.Builder, nameSystems namer.NameSystems, canonicalOrder
 		return nil, err
 	}
 
+	c := NewUniverseContext(universe, b.FindPackages(), nameSystems, canonicalOrderName)
+	c.builder = b
+	return c, nil
+}
+
+// NewContextWithContext is like NewContext, but stops parsing once ctx is
+// done. In that case the returned error wraps ctx.Err(), so it can be
+// recognized with errors.Is.
+func NewContextWithContext(ctx context.Context, b *parser.Builder, nameSystems namer.NameSystems, canonicalOrderName string) (*Context, error) {
+	universe, err := b.FindTypesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewUniverseContext(universe, b.FindPackages(), nameSystems, canonicalOrderName)
+	c.builder = b
+	return c, nil
+}
+
+// NewUniverseContext generates a context from an already loaded universe, e.g.
+// one decoded with types.UnmarshalUniverse. 'inputs' are the user-specified
+// packages. Since there is no parser behind such a context, packages can't be
+// added to it with AddDir or AddDirectory.
+func NewUniverseContext(universe types.Universe, inputs []string, nameSystems namer.NameSystems, canonicalOrderName string) *Context {
 	c := &Context{
-		Namers:   namer.NameSystems{},
 		Universe: universe,
-		Inputs:   b.FindPackages(),
+		Inputs:   inputs,
 		FileTypes: map[string]FileType{
 			GolangFileType: NewGolangFile(),
 		},
-		builder: b,
+		DiffContext: DefaultDiffContext,
+		results:     &executionResults{},
 	}
+	c.setNameSystems(nameSystems, canonicalOrderName)
+	return c
+}
 
+// ForNameSystems returns a copy of the context which uses the given naming
+// systems, and the canonical ordering of the named one, instead of the
+// context's own. The copy shares everything else, including the universe, so
+// several sets of generators can run over a single parse.
+func (ctxt *Context) ForNameSystems(nameSystems namer.NameSystems, canonicalOrderName string) *Context {
+	c := *ctxt
+	c.setNameSystems(nameSystems, canonicalOrderName)
+	return &c
+}
+
+func (ctxt *Context) setNameSystems(nameSystems namer.NameSystems, canonicalOrderName string) {
+	ctxt.Namers = namer.NameSystems{}
+	ctxt.Order = nil
 	for name, systemNamer := range nameSystems {
-		c.Namers[name] = systemNamer
+		ctxt.Namers[name] = systemNamer
 		if name == canonicalOrderName {
 			orderer := namer.Orderer{Namer: systemNamer}
-			c.Order = orderer.OrderUniverse(universe)
+			ctxt.Order = orderer.OrderUniverse(ctxt.Universe)
 		}
 	}
-	return c, nil
 }
 
+// FileImports returns the import tracker of the file the generator is writing
+// to, which is shared by all the generators writing to that file, so that they
+// agree on the names of the packages they import. The imports it tracks are
+// added to the file; they need not be returned by Generator.Imports. It is
+// available from Namers onwards, e.g.:
+//
+//	func (g *myGen) Namers(c *generator.Context) namer.NameSystems {
+//		return namer.NameSystems{
+//			"raw": namer.NewRawNamer(g.outputPackage, c.FileImports()),
+//		}
+//	}
+//
+// It returns nil outside of generation.
+func (ctxt *Context) FileImports() namer.ImportTracker {
+	if ctxt.file == nil {
+		return nil
+	}
+	return ctxt.file.ImportTracker
+}
+
+var errNoBuilder = errors.New("packages can't be added to a context which was not made from a parser")
+
 // IncomingImports returns the incoming imports for each package. The map is lazily computed.
 func (ctxt *Context) IncomingImports() map[string][]string {
 	if ctxt.incomingImports == nil {
@@ -241,6 +495,9 @@ func (ctxt *Context) TransitiveIncomingImports() map[string][]string {
 // (`which go`) will all be searched, in the normal Go fashion.
 // Deprecated. Please use AddDirectory.
 func (ctxt *Context) AddDir(path string) error {
+	if ctxt.builder == nil {
+		return errNoBuilder
+	}
 	ctxt.incomingImports = nil
 	ctxt.incomingTransitiveImports = nil
 	return ctxt.builder.AddDirTo(path, &ctxt.Universe)
@@ -250,6 +507,9 @@ func (ctxt *Context) AddDir(path string) error {
 // single go package import path.  GOPATH, GOROOT, and the location of your go
 // binary (`which go`) will all be searched, in the normal Go fashion.
 func (ctxt *Context) AddDirectory(path string) (*types.Package, error) {
+	if ctxt.builder == nil {
+		return nil, errNoBuilder
+	}
 	ctxt.incomingImports = nil
 	ctxt.incomingTransitiveImports = nil
 	return ctxt.builder.AddDirectoryTo(path, &ctxt.Universe)
@@ -27,14 +27,46 @@ import (
 )
 
 func NewImportTracker(typesToAdd ...*types.Type) namer.ImportTracker {
-	tracker := namer.NewDefaultImportTracker(types.Name{})
+	tracker := newGolangImportTracker(types.Name{})
+	tracker.AddTypes(typesToAdd...)
+	return tracker
+}
+
+// NewImportTracker returns an import tracker which names packages according to
+// the context's ImportAliasPolicy, if any.
+func (c *Context) NewImportTracker(typesToAdd ...*types.Type) namer.ImportTracker {
+	tracker := newGolangImportTracker(types.Name{})
+	tracker.AliasPolicy = c.ImportAliasPolicy
+	tracker.AddTypes(typesToAdd...)
+	return tracker
+}
+
+// newFileImportTracker returns the import tracker of a file in the package at
+// pkgPath, which never imports the package itself. See Context.FileImports.
+func newFileImportTracker(pkgPath string, policy *namer.ImportAliasPolicy) namer.ImportTracker {
+	tracker := newGolangImportTracker(types.Name{Package: pkgPath})
+	tracker.AliasPolicy = policy
+	return tracker
+}
+
+func newGolangImportTracker(local types.Name) *namer.DefaultImportTracker {
+	tracker := namer.NewDefaultImportTracker(local)
 	tracker.IsInvalidType = func(*types.Type) bool { return false }
 	tracker.LocalName = func(name types.Name) string { return golangTrackerLocalName(&tracker, name) }
 	tracker.PrintImport = func(path, name string) string { return name + " \"" + path + "\"" }
-
-	tracker.AddTypes(typesToAdd...)
 	return &tracker
+}
 
+// parseImportLine splits an import line, as returned by Generator.Imports, into
+// the name it gives the package (if any) and the package's path.
+func parseImportLine(line string) (name, path string) {
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, "\""); i >= 0 {
+		name = strings.TrimSpace(line[:i])
+		path = strings.Trim(line[i:], "\"")
+		return name, path
+	}
+	return "", line
 }
 
 func golangTrackerLocalName(tracker namer.ImportTracker, t types.Name) string {
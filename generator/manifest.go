@@ -0,0 +1,373 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+)
+
+// ManifestVersion identifies the format of manifests.
+const ManifestVersion = "gengo/manifest/v1"
+
+// Manifest records what each output package was generated from: the hashes of
+// the input packages and their transitive imports, the generator version, and
+// the hashes of the files generated. With a manifest set on the context, a
+// package whose inputs and outputs are unchanged since it was recorded is
+// skipped. Manifests are safe for concurrent use.
+type Manifest struct {
+	lock sync.Mutex
+
+	Version string `json:"version"`
+	// The hashes of the source of the packages the outputs were generated
+	// from, and of the packages they import, by package path.
+	PackageHashes map[string]string `json:"packageHashes"`
+	// The output packages, sorted by package path and generators.
+	Outputs []*ManifestOutput `json:"outputs"`
+
+	// The package hashes as they were loaded, to report what changed.
+	previous map[string]string
+}
+
+// ManifestOutput records what an output package was generated from.
+type ManifestOutput struct {
+	// The import path of the output package.
+	Package string `json:"package"`
+	// The names of the generators of the package. A package may be
+	// generated by several sets of generators (e.g. those run by a driver),
+	// each recorded separately.
+	Generators       []string `json:"generators"`
+	GeneratorVersion string   `json:"generatorVersion,omitempty"`
+	// A hash of the generator settings, if any. See
+	// Context.GeneratorSettings.
+	SettingsHash string `json:"settingsHash,omitempty"`
+	// The packages with types which passed the package's filter.
+	Inputs []string `json:"inputs"`
+	// A hash of everything the package was generated from: the generator
+	// version and settings, the inputs and their transitive imports, and
+	// the headers of the files.
+	InputHash string         `json:"inputHash"`
+	Files     []ManifestFile `json:"files"`
+}
+
+// ManifestFile records a generated file.
+type ManifestFile struct {
+	Name       string   `json:"name"`
+	Hash       string   `json:"hash"`
+	Generators []string `json:"generators,omitempty"`
+}
+
+// ManifestResult says whether a package was skipped thanks to the manifest and,
+// if not, why it had to be generated.
+type ManifestResult struct {
+	Package    string
+	Generators []string
+	Skipped    bool
+	// What changed, e.g. the paths of input packages whose source changed.
+	Changes []string
+}
+
+// NewManifest returns an empty manifest.
+func NewManifest() *Manifest {
+	return &Manifest{
+		Version:       ManifestVersion,
+		PackageHashes: map[string]string{},
+		previous:      map[string]string{},
+	}
+}
+
+// ReadManifest reads the manifest at path. If there is no such file, or it was
+// written by an incompatible version, it returns an empty manifest.
+func ReadManifest(out Output, path string) (*Manifest, error) {
+	data, err := out.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewManifest(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := NewManifest()
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("unable to read manifest %q: %v", path, err)
+	}
+	if m.Version != ManifestVersion {
+		klog.Warningf("Ignoring manifest %q: it has version %q, expected %q", path, m.Version, ManifestVersion)
+		return NewManifest(), nil
+	}
+	if m.PackageHashes == nil {
+		m.PackageHashes = map[string]string{}
+	}
+	for path, hash := range m.PackageHashes {
+		m.previous[path] = hash
+	}
+	return m, nil
+}
+
+// Write writes the manifest to path.
+func (m *Manifest) Write(out Output, path string) error {
+	m.lock.Lock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	m.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return out.WriteFile(path, append(data, '\n'))
+}
+
+// lookup returns the recorded output for the package and generators, or nil.
+func (m *Manifest) lookup(pkg string, generators []string) *ManifestOutput {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, o := range m.Outputs {
+		if o.Package == pkg && reflect.DeepEqual(o.Generators, generators) {
+			return o
+		}
+	}
+	return nil
+}
+
+// hadShards returns whether the files recorded for the package include shards
+// of the file with the given name, other than itself. A nil manifest has
+// none.
+func (m *Manifest) hadShards(pkg, name string) bool {
+	if m == nil {
+		return false
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, o := range m.Outputs {
+		if o.Package != pkg {
+			continue
+		}
+		for _, f := range o.Files {
+			if isShardName(name, f.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// record adds or replaces the output, along with the hashes of its packages.
+func (m *Manifest) record(o *ManifestOutput, hashes map[string]string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for path, hash := range hashes {
+		m.PackageHashes[path] = hash
+	}
+	for i, existing := range m.Outputs {
+		if existing.Package == o.Package && reflect.DeepEqual(existing.Generators, o.Generators) {
+			m.Outputs[i] = o
+			return
+		}
+	}
+	m.Outputs = append(m.Outputs, o)
+	sort.SliceStable(m.Outputs, func(i, j int) bool {
+		a, b := m.Outputs[i], m.Outputs[j]
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return strings.Join(a.Generators, ",") < strings.Join(b.Generators, ",")
+	})
+}
+
+// changedPackages returns those of the packages whose hashes differ from the
+// ones the manifest was loaded with.
+func (m *Manifest) changedPackages(hashes map[string]string) []string {
+	changed := []string{}
+	for path, hash := range hashes {
+		if m.previous[path] != hash {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// manifestOutput describes what p is about to be generated from. It returns
+// nil if that can't be known, i.e. if the context was not made from a parser.
+// The hashes of all the packages involved are returned too.
+func (c *Context) manifestOutput(p Package, packageContext *Context, generators []Generator) (*ManifestOutput, map[string]string) {
+	if c.builder == nil {
+		return nil, nil
+	}
+	o := &ManifestOutput{
+		Package:          p.Path(),
+		Generators:       []string{},
+		GeneratorVersion: c.GeneratorVersion,
+		Inputs:           []string{},
+	}
+	if c.GeneratorSettings != "" {
+		o.SettingsHash = hashOf([]byte(c.GeneratorSettings))
+	}
+	inputs := map[string]bool{}
+	if _, found := c.Universe[p.Path()]; found {
+		inputs[p.Path()] = true
+	}
+	for _, t := range packageContext.Order {
+		if t.Name.Package != "" {
+			inputs[t.Name.Package] = true
+		}
+	}
+	for input := range inputs {
+		o.Inputs = append(o.Inputs, input)
+	}
+	sort.Strings(o.Inputs)
+
+	// Hash the inputs and everything they import.
+	hashes := map[string]string{}
+	var visit func(path string)
+	visit = func(path string) {
+		if _, done := hashes[path]; done {
+			return
+		}
+		hashes[path], _ = c.builder.PackageHash(path)
+		imports, _ := c.builder.PackageImports(path)
+		for _, imp := range imports {
+			visit(imp)
+		}
+	}
+	for _, input := range o.Inputs {
+		visit(input)
+	}
+	paths := []string{}
+	for path := range hashes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "version %s\n", c.GeneratorVersion)
+	fmt.Fprintf(h, "settings %s\n", o.SettingsHash)
+	headers := map[string]bool{}
+	for _, g := range generators {
+		o.Generators = append(o.Generators, g.Name())
+		fmt.Fprintf(h, "generator %s %s %s\n", g.Name(), g.Filename(), g.FileType())
+		if !headers[g.Filename()] {
+			headers[g.Filename()] = true
+			fmt.Fprintf(h, "header %x\n", sha256.Sum256(p.Header(g.Filename())))
+		}
+	}
+	for _, input := range o.Inputs {
+		fmt.Fprintf(h, "input %s\n", input)
+	}
+	for _, path := range paths {
+		fmt.Fprintf(h, "package %s %s\n", path, hashes[path])
+	}
+	o.InputHash = hex.EncodeToString(h.Sum(nil))
+	return o, hashes
+}
+
+// manifestChanges returns why the package described by o has to be generated
+// again, or nothing if it can be skipped.
+func (c *Context) manifestChanges(out Output, outDir string, o *ManifestOutput, hashes map[string]string) []string {
+	recorded := c.Manifest.lookup(o.Package, o.Generators)
+	if recorded == nil {
+		return []string{"not generated before"}
+	}
+	if recorded.InputHash != o.InputHash {
+		changes := []string{}
+		if recorded.GeneratorVersion != o.GeneratorVersion {
+			changes = append(changes, "generator version")
+		}
+		if recorded.SettingsHash != o.SettingsHash {
+			changes = append(changes, "generator settings")
+		}
+		changes = append(changes, c.Manifest.changedPackages(hashes)...)
+		if len(changes) == 0 {
+			changes = append(changes, "inputs")
+		}
+		return changes
+	}
+	changes := []string{}
+	for _, f := range recorded.Files {
+		content, err := out.ReadFile(filepath.Join(outDir, o.Package, f.Name))
+		if err != nil || hashOf(content) != f.Hash {
+			changes = append(changes, "output "+f.Name)
+		}
+	}
+	return changes
+}
+
+// skipPackage records the files of a package skipped thanks to the manifest as
+// if they had been verified or written.
+func (c *Context) skipPackage(outDir string, o *ManifestOutput) {
+	recorded := c.Manifest.lookup(o.Package, o.Generators)
+	for _, f := range recorded.Files {
+		c.results.addGenerated(filepath.Join(outDir, o.Package, f.Name))
+		if c.Verify {
+			c.results.addVerified(VerifyResult{
+				Path:       filepath.ToSlash(filepath.Join(o.Package, f.Name)),
+				Package:    o.Package,
+				Generators: f.Generators,
+				Status:     VerifyUpToDate,
+			})
+		} else {
+			c.results.addWritten(false)
+		}
+	}
+}
+
+// recordPackage records the files generated for a package in the manifest.
+// They are read back from the output; if that is not possible (e.g. with an
+// archive), nothing is recorded.
+func (c *Context) recordPackage(out Output, outDir string, o *ManifestOutput, hashes map[string]string, files []*File) {
+	all := []*File{}
+	for _, f := range files {
+		all = append(all, f)
+		if c.hasSourceMap(f) {
+			all = append(all, sourceMapOf(f))
+		}
+	}
+	for _, f := range all {
+		content, err := out.ReadFile(filepath.Join(outDir, f.PackagePath, f.Name))
+		if err != nil {
+			klog.V(2).Infof("Not recording package %q in the manifest: %v", o.Package, err)
+			return
+		}
+		o.Files = append(o.Files, ManifestFile{Name: f.Name, Hash: hashOf(content), Generators: f.Generators})
+	}
+	c.Manifest.record(o, hashes)
+}
+
+func hashOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ManifestResults returns, for each package executed with a manifest, whether
+// it was skipped, or what changed. They are sorted by package.
+func (c *Context) ManifestResults() []ManifestResult {
+	if c.results == nil {
+		return nil
+	}
+	c.results.lock.Lock()
+	defer c.results.lock.Unlock()
+	out := append([]ManifestResult{}, c.results.manifest...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Package < out[j].Package })
+	return out
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/parser"
+	"k8s.io/gengo/types"
+)
+
+// manifestTestContext returns a context with the types of src, as package
+// base/foo, and a package which generates a constant per struct in
+// example.com/out/names.go.
+func manifestTestContext(t *testing.T, src string) (*generator.Context, generator.Packages) {
+	c := construct(t, map[string]string{"base/foo/foo.go": src})
+	packages := generator.Packages{&generator.DefaultPackage{
+		PackageName: "out",
+		PackagePath: "example.com/out",
+		FilterFunc: func(c *generator.Context, t *types.Type) bool {
+			return t.Kind == types.Struct
+		},
+		GeneratorList: []generator.Generator{&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "names"}}},
+	}}
+	return c, packages
+}
+
+func TestManifest(t *testing.T) {
+	out := generator.NewMemoryOutput()
+	manifest := generator.NewManifest()
+	run := func(src string) []generator.ManifestResult {
+		c, packages := manifestTestContext(t, src)
+		c.Output = out
+		c.Manifest = manifest
+		c.GeneratorVersion = "v1"
+		if err := c.ExecutePackages("/out", packages); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Round-trip the manifest, as separate runs would.
+		if err := manifest.Write(out, "/out/manifest.json"); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if manifest, err = generator.ReadManifest(out, "/out/manifest.json"); err != nil {
+			t.Fatal(err)
+		}
+		return c.ManifestResults()
+	}
+
+	const blah = "package foo\n\ntype Blah struct{}\n"
+	results := run(blah)
+	if len(results) != 1 || results[0].Skipped {
+		t.Fatalf("expected the first run to generate the package, got %+v", results)
+	}
+	if e, a := []string{"names.go"}, manifest.Outputs[0].Files; len(a) != 1 || a[0].Name != e[0] {
+		t.Errorf("unexpected files in the manifest: %+v", a)
+	}
+
+	results = run(blah)
+	if len(results) != 1 || !results[0].Skipped {
+		t.Errorf("expected an unchanged package to be skipped, got %+v", results)
+	}
+
+	out.WriteFile("/out/example.com/out/names.go", []byte("// Code generated by hand.\npackage out\n"))
+	results = run(blah)
+	if e, a := []string{"output names.go"}, results[0].Changes; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted changes %v, got %v", e, a)
+	}
+
+	results = run("package foo\n\ntype Blah struct{}\n\ntype Other struct{}\n")
+	if e, a := []string{"/tmp/base/foo/foo.go"}, results[0].Changes; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted changes %v, got %v", e, a)
+	}
+	content, _ := out.ReadFile("/out/example.com/out/names.go")
+	if !strings.Contains(string(content), "OtherName") {
+		t.Errorf("expected the package to be generated again, got:\n%s", content)
+	}
+}
+
+func TestManifestNotRecordedWhenVerifying(t *testing.T) {
+	out := generator.NewMemoryOutput()
+	manifest := generator.NewManifest()
+	run := func(src string, verify bool) []generator.ManifestResult {
+		c, packages := manifestTestContext(t, src)
+		c.Output = out
+		c.Manifest = manifest
+		c.Verify = verify
+		// The file isn't compared when verifying, so verifying succeeds
+		// even though it is stale.
+		c.FileTypes["json"] = unverifiedFile{generator.DefaultFileType{
+			Format:   func(b []byte) ([]byte, error) { return b, nil },
+			Assemble: func(w io.Writer, f *generator.File) { w.Write(f.Body.Bytes()) },
+		}}
+		packages[0].(*generator.DefaultPackage).GeneratorList = []generator.Generator{&jsonGen{}}
+		if err := c.ExecutePackages("/out", packages); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return c.ManifestResults()
+	}
+
+	run("package foo\n\ntype Blah struct{}\n", false)
+	src := "package foo\n\ntype Blah struct{}\n\ntype Other struct{}\n"
+	run(src, true)
+	if results := run(src, false); results[0].Skipped {
+		t.Errorf("expected the package to be generated, got %+v", results)
+	}
+	if content, _ := out.ReadFile("/out/example.com/out/names.json"); !strings.Contains(string(content), "Other") {
+		t.Errorf("unexpected content: %q", content)
+	}
+}
+
+func TestManifestTransitiveImports(t *testing.T) {
+	const a, c = "k8s.io/gengo/testdata/manifest/a", "k8s.io/gengo/testdata/manifest/c"
+	out := generator.NewMemoryOutput()
+	manifest := generator.NewManifest()
+	run := func(settings string) []generator.ManifestResult {
+		b := parser.New()
+		if err := b.AddDir(a); err != nil {
+			t.Fatal(err)
+		}
+		ctx, err := generator.NewContext(b, namer.NameSystems{"public": namer.NewPublicNamer(0)}, "public")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx.Output = out
+		ctx.Manifest = manifest
+		ctx.GeneratorSettings = settings
+		packages := generator.Packages{&generator.DefaultPackage{
+			PackageName: "out",
+			PackagePath: "example.com/out",
+			FilterFunc: func(c *generator.Context, t *types.Type) bool {
+				return t.Kind == types.Struct && t.Name.Package == a
+			},
+			GeneratorList: []generator.Generator{&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "names"}}},
+		}}
+		if err := ctx.ExecutePackages("/out", packages); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := manifest.Write(out, "/out/manifest.json"); err != nil {
+			t.Fatal(err)
+		}
+		if manifest, err = generator.ReadManifest(out, "/out/manifest.json"); err != nil {
+			t.Fatal(err)
+		}
+		return ctx.ManifestResults()
+	}
+
+	run("")
+	// a imports b, which imports c: c is not an input, but it is hashed.
+	if _, found := manifest.PackageHashes[c]; !found {
+		t.Fatalf("expected %s to be hashed, got %v", c, manifest.PackageHashes)
+	}
+
+	// Pretend c has changed since.
+	manifest.PackageHashes[c] = "stale"
+	manifest.Outputs[0].InputHash = "stale"
+	if err := manifest.Write(out, "/out/manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if manifest, err = generator.ReadManifest(out, "/out/manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+	results := run("")
+	if e, a := []string{c}, results[0].Changes; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted changes %v, got %v", e, a)
+	}
+
+	if results := run(""); !results[0].Skipped {
+		t.Errorf("expected an unchanged package to be skipped, got %+v", results)
+	}
+	results = run("--other-flag")
+	if e, a := []string{"generator settings"}, results[0].Changes; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted changes %v, got %v", e, a)
+	}
+}
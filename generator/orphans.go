@@ -0,0 +1,145 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+// RemoveOrphans looks for orphaned files: files which carry one of the
+// context's OrphanMarkers in their leading comments, but which were not
+// produced by any Execute* call on this context (or the contexts derived from
+// it). It looks in the directories of all the packages executed so far, and
+// those of the context's Inputs, under outDir.
+//
+// If c.Verify is set, orphans are recorded as VerifyOrphaned results and
+// reported as an error; otherwise they are removed. Only outputs implementing
+// DirOutput can be searched; with other outputs, this does nothing.
+//
+// ExecutePackages calls this itself if OrphanMarkers is set. Call it directly
+// when several sets of packages write to the same directories, e.g. after
+// running each of several generators with ExecutePackages on contexts without
+// OrphanMarkers.
+func (c *Context) RemoveOrphans(outDir string) error {
+	if len(c.OrphanMarkers) == 0 {
+		return nil
+	}
+	out, ok := c.Output.(DirOutput)
+	if c.Output == nil {
+		out, ok = DiskOutput{}, true
+	}
+	if !ok {
+		klog.V(2).Infof("Not looking for orphaned files: the output can't list files")
+		return nil
+	}
+
+	dirs, generated := c.results.executed()
+	for _, input := range c.Inputs {
+		dirs = append(dirs, filepath.Join(outDir, input))
+	}
+	sort.Strings(dirs)
+
+	var errors []string
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		names, err := out.ReadDir(dir)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("unable to list %q: %v", dir, err))
+			continue
+		}
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			// Skip hidden files, including DiskOutput's temporary files.
+			if generated[path] || strings.HasPrefix(name, ".") {
+				continue
+			}
+			content, err := out.ReadFile(path)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("unable to read %q: %v", path, err))
+				continue
+			}
+			if !hasMarker(content, c.OrphanMarkers) {
+				continue
+			}
+			if err := c.orphaned(out, outDir, path, content); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("orphaned files:\n%v\n", strings.Join(errors, "\n"))
+	}
+	return nil
+}
+
+// orphaned reports or removes the orphaned file at path.
+func (c *Context) orphaned(out DirOutput, outDir, path string, content []byte) error {
+	name := path
+	if rel, err := filepath.Rel(outDir, path); err == nil {
+		name = rel
+	}
+	name = filepath.ToSlash(name)
+	if !c.Verify {
+		klog.V(1).Infof("Removing orphaned file %q", path)
+		return out.RemoveFile(path)
+	}
+	result := VerifyResult{
+		Path:    name,
+		Package: filepath.ToSlash(filepath.Dir(name)),
+		Status:  VerifyOrphaned,
+		Diff:    UnifiedDiff("a/"+name, "/dev/null", content, nil, c.DiffContext),
+	}
+	result.LinesAdded, result.LinesRemoved = diffStat(result.Diff)
+	c.results.addVerified(result)
+	return fmt.Errorf("%q is no longer generated", name)
+}
+
+// hasMarker returns whether one of the markers is in the comments at the top of
+// content, before any code.
+func hasMarker(content []byte, markers []string) bool {
+	s := bufio.NewScanner(bytes.NewReader(content))
+	inBlock := false
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case inBlock:
+			inBlock = !strings.Contains(line, "*/")
+		case line == "", strings.HasPrefix(line, "//"):
+		case strings.HasPrefix(line, "/*"):
+			inBlock = !strings.Contains(line[2:], "*/")
+		default:
+			return false
+		}
+		for _, m := range markers {
+			if strings.Contains(line, m) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/gengo/generator"
+)
+
+// orphansTestContext returns a context with a single type, and a package
+// which generates example.com/out/names.go from it.
+func orphansTestContext(t *testing.T) (*generator.Context, generator.Packages) {
+	c := construct(t, map[string]string{"base/foo/foo.go": "package foo\n\ntype Blah struct{}\n"})
+	packages := generator.Packages{&generator.DefaultPackage{
+		PackageName:   "out",
+		PackagePath:   "example.com/out",
+		GeneratorList: []generator.Generator{&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "names"}}},
+	}}
+	return c, packages
+}
+
+func TestRemoveOrphans(t *testing.T) {
+	out := generator.NewMemoryOutput()
+	orphan := "/out/example.com/out/old.go"
+	orphanContent := "/*\nCopyright.\n*/\n\n// Code generated by test. DO NOT EDIT.\n\npackage out\n"
+	out.WriteFile(orphan, []byte(orphanContent))
+	handWritten := []string{
+		"/out/example.com/out/doc.go",
+		"/out/base/foo/foo.go",
+	}
+	out.WriteFile(handWritten[0], []byte("// Package out is not generated.\npackage out\n\n// Code generated by test. DO NOT EDIT.\n"))
+	out.WriteFile(handWritten[1], []byte("package foo\n"))
+
+	c, packages := orphansTestContext(t)
+	c.Output = out
+	c.OrphanMarkers = []string{"Code generated by test"}
+	c.Verify = true
+	if err := c.ExecutePackages("/out", packages); err == nil || !strings.Contains(err.Error(), "no longer generated") {
+		t.Fatalf("expected an orphan error, got %v", err)
+	}
+	var orphans []generator.VerifyResult
+	for _, r := range c.VerifyResults() {
+		if r.Status == generator.VerifyOrphaned {
+			orphans = append(orphans, r)
+		}
+	}
+	if len(orphans) != 1 || orphans[0].Path != "example.com/out/old.go" || orphans[0].LinesRemoved != 7 {
+		t.Fatalf("unexpected orphans: %+v", orphans)
+	}
+
+	c, packages = orphansTestContext(t)
+	c.Output = out
+	c.OrphanMarkers = []string{"Code generated by test"}
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := out.ReadFile(orphan); !os.IsNotExist(err) {
+		t.Errorf("expected the orphan to be removed, got %v", err)
+	}
+	for _, path := range handWritten {
+		if _, err := out.ReadFile(path); err != nil {
+			t.Errorf("expected %q to be kept, got %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Output is where generated files go. Paths are those of the files on disk,
+// i.e. the output directory joined with the package path and file name.
+// Implementations must be safe for concurrent use.
+type Output interface {
+	// WriteFile stores the content of the file at path, creating any
+	// directories it needs.
+	WriteFile(path string, content []byte) error
+
+	// ReadFile returns the current content of the file at path. If there
+	// is no such file, the error satisfies os.IsNotExist.
+	ReadFile(path string) ([]byte, error)
+}
+
+// DirOutput is implemented by outputs which can also list and remove files.
+// Orphaned files can only be found in such outputs; see
+// Context.RemoveOrphans.
+type DirOutput interface {
+	Output
+
+	// ReadDir returns the names of the files (not directories) in dir. If
+	// there is no such directory, it returns no names and no error.
+	ReadDir(dir string) ([]string, error)
+
+	// RemoveFile removes the file at path.
+	RemoveFile(path string) error
+}
+
+// FileRenderer is implemented by file types which can produce the content of
+// a file without writing it. The content of files of such types is written to
+// (and verified against) the context's Output; other file types write files
+// themselves, with AssembleFile.
+type FileRenderer interface {
+	// RenderFile returns the final content of f. If the content can be
+	// assembled but not formatted, it returns the unformatted content along
+	// with the error, so that it can be written anyway for inspection.
+	RenderFile(f *File) ([]byte, error)
+}
+
+// NoVerify is implemented by file types whose files are written like the
+// others, but are never compared with the existing ones when verifying, e.g.
+// because they are also edited by hand.
+type NoVerify interface {
+	// NoVerify returns true if files of this type are not verified.
+	NoVerify() bool
+}
+
+// DiskOutput writes files to disk. It is the default Output.
+//
+// Files are written atomically: the content goes to a temporary file in the
+// same directory, which is then renamed over the destination, so readers never
+// see a partially written file. Replaced files keep their mode; new ones are
+// created with mode 0644.
+type DiskOutput struct{}
+
+func (DiskOutput) WriteFile(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// Clean up if anything goes wrong; after the rename, this fails harmlessly.
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// Keep the mode of the file being replaced.
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (DiskOutput) ReadFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+func (DiskOutput) ReadDir(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+func (DiskOutput) RemoveFile(path string) error {
+	return os.Remove(path)
+}
+
+// MemoryOutput keeps files in memory, e.g. to inspect them in tests or to
+// stage them for review.
+type MemoryOutput struct {
+	lock  sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemoryOutput returns an empty MemoryOutput.
+func NewMemoryOutput() *MemoryOutput {
+	return &MemoryOutput{files: map[string][]byte{}}
+}
+
+func (m *MemoryOutput) WriteFile(path string, content []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.files[path] = append([]byte(nil), content...)
+	return nil
+}
+
+func (m *MemoryOutput) ReadFile(path string) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	content, found := m.files[path]
+	if !found {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), content...), nil
+}
+
+func (m *MemoryOutput) ReadDir(dir string) ([]string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	names := []string{}
+	for path := range m.files {
+		if filepath.Dir(path) == filepath.Clean(dir) {
+			names = append(names, filepath.Base(path))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MemoryOutput) RemoveFile(path string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, found := m.files[path]; !found {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+	delete(m.files, path)
+	return nil
+}
+
+// Files returns the paths of all files written so far, sorted.
+func (m *MemoryOutput) Files() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	paths := []string{}
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// OutputFunc adapts a function to the Output interface. It is called for every
+// file written; there are never any existing files.
+type OutputFunc func(path string, content []byte) error
+
+func (f OutputFunc) WriteFile(path string, content []byte) error {
+	return f(path, content)
+}
+
+func (f OutputFunc) ReadFile(path string) ([]byte, error) {
+	return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+}
+
+// archiveEpoch is the default modification time of the files in archives:
+// the earliest time zip archives can record.
+var archiveEpoch = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveOutput is the shared part of TarOutput and ZipOutput.
+type archiveOutput struct {
+	// ModTime is the modification time of all the files in the archive, so
+	// that the archive only depends on their content. It defaults to
+	// 1980-01-01 UTC.
+	ModTime time.Time
+
+	lock sync.Mutex
+	base string
+}
+
+// name returns the name of the archive entry for path.
+func (a *archiveOutput) name(path string) string {
+	if rel, err := filepath.Rel(a.base, path); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+func (a *archiveOutput) ReadFile(path string) ([]byte, error) {
+	return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+}
+
+// TarOutput writes files to a tar archive, named relative to a base
+// directory (usually the output directory). Close must be called to finish
+// the archive.
+type TarOutput struct {
+	archiveOutput
+	w *tar.Writer
+}
+
+// NewTarOutput returns an Output which writes a tar archive to w.
+func NewTarOutput(w io.Writer, base string) *TarOutput {
+	return &TarOutput{archiveOutput: archiveOutput{ModTime: archiveEpoch, base: base}, w: tar.NewWriter(w)}
+}
+
+func (t *TarOutput) WriteFile(path string, content []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	hdr := &tar.Header{
+		Name:    t.name(path),
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: t.ModTime,
+	}
+	if err := t.w.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := t.w.Write(content)
+	return err
+}
+
+// Close finishes the archive. It does not close the underlying writer.
+func (t *TarOutput) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.w.Close()
+}
+
+// ZipOutput writes files to a zip archive, named relative to a base
+// directory (usually the output directory). Close must be called to finish
+// the archive.
+type ZipOutput struct {
+	archiveOutput
+	w *zip.Writer
+}
+
+// NewZipOutput returns an Output which writes a zip archive to w.
+func NewZipOutput(w io.Writer, base string) *ZipOutput {
+	return &ZipOutput{archiveOutput: archiveOutput{ModTime: archiveEpoch, base: base}, w: zip.NewWriter(w)}
+}
+
+func (z *ZipOutput) WriteFile(path string, content []byte) error {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	hdr := &zip.FileHeader{Name: z.name(path), Method: zip.Deflate}
+	hdr.Modified = z.ModTime
+	hdr.SetMode(0644)
+	w, err := z.w.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// Close finishes the archive. It does not close the underlying writer.
+func (z *ZipOutput) Close() error {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	return z.w.Close()
+}
+
+var (
+	_ = DirOutput(DiskOutput{})
+	_ = DirOutput(&MemoryOutput{})
+	_ = Output(OutputFunc(nil))
+	_ = Output(&TarOutput{})
+	_ = Output(&ZipOutput{})
+)
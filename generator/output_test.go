@@ -0,0 +1,262 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/types"
+)
+
+func outputTestContext(t *testing.T) (*generator.Context, generator.Packages) {
+	c := construct(t, map[string]string{
+		"base/foo/foo.go": `
+package foo
+
+type Blah struct{}
+`,
+	})
+	packages := generator.Packages{&generator.DefaultPackage{
+		PackageName: "out",
+		PackagePath: "example.com/out",
+		FilterFunc: func(c *generator.Context, t *types.Type) bool {
+			return t.Kind == types.Struct
+		},
+		GeneratorList: []generator.Generator{&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "names"}}},
+	}}
+	return c, packages
+}
+
+func TestMemoryOutput(t *testing.T) {
+	c, packages := outputTestContext(t)
+	out := generator.NewMemoryOutput()
+	c.Output = out
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := []string{"/out/example.com/out/names.go"}, out.Files(); !reflect.DeepEqual(e, a) {
+		t.Fatalf("wanted files %v, got %v", e, a)
+	}
+	content, err := out.ReadFile("/out/example.com/out/names.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := "package out\n\nconst BlahName = \"Blah\"\n", string(content); e != a {
+		t.Errorf("wanted:\n%s\ngot:\n%s", e, a)
+	}
+
+	c.Verify = true
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Errorf("unexpected verification error: %v", err)
+	}
+	out.WriteFile("/out/example.com/out/names.go", []byte("package out\n"))
+	if err := c.ExecutePackages("/out", packages); err == nil {
+		t.Errorf("expected a verification error")
+	}
+}
+
+// archiveEpoch is the default modification time of the files in archives.
+var archiveEpoch = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestTarOutput(t *testing.T) {
+	c, packages := outputTestContext(t)
+	buf := &bytes.Buffer{}
+	out := generator.NewTarOutput(buf, "/out")
+	c.Output = out
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := tar.NewReader(buf)
+	names := []string{}
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if e, a := archiveEpoch, hdr.ModTime; !e.Equal(a) {
+			t.Errorf("wanted modification time %v, got %v", e, a)
+		}
+	}
+	if e, a := []string{"example.com/out/names.go"}, names; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted entries %v, got %v", e, a)
+	}
+}
+
+func TestZipOutput(t *testing.T) {
+	c, packages := outputTestContext(t)
+	buf := &bytes.Buffer{}
+	out := generator.NewZipOutput(buf, "/out")
+	out.ModTime = time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC)
+	c.Output = out
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		if e, a := out.ModTime, f.Modified; !e.Equal(a) {
+			t.Errorf("wanted modification time %v, got %v", e, a)
+		}
+	}
+	if e, a := []string{"example.com/out/names.go"}, names; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted entries %v, got %v", e, a)
+	}
+}
+
+func TestDiskOutputSkipsUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gengo-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, packages := outputTestContext(t)
+	if err := c.ExecutePackages(dir, packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := (generator.WriteSummary{Written: 1}), c.WriteSummary(); e != a {
+		t.Errorf("wanted %+v, got %+v", e, a)
+	}
+
+	path := filepath.Join(dir, "example.com/out/names.go")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	c, packages = outputTestContext(t)
+	if err := c.ExecutePackages(dir, packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := (generator.WriteSummary{Unchanged: 1}), c.WriteSummary(); e != a {
+		t.Errorf("wanted %+v, got %+v", e, a)
+	}
+	if info, err := os.Stat(path); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("the unchanged file was rewritten: %v, %v", info.ModTime(), err)
+	}
+	if e, a := []string{"/example.com/out/names.go"}, keys(readTree(t, dir)); !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted files %v, got %v", e, a)
+	}
+}
+
+func TestDiskOutputKeepsMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gengo-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := generator.DiskOutput{}
+	path := filepath.Join(dir, "new.go")
+	if err := out.WriteFile(path, []byte("package out\n")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("expected a new file to have mode 0644, got %v", info.Mode())
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.WriteFile(path, []byte("package out\n\nconst A = 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the file to keep mode 0600, got %v", info.Mode())
+	}
+}
+
+func keys(m map[string]string) []string {
+	out := []string{}
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestVerifyResults(t *testing.T) {
+	c, packages := outputTestContext(t)
+	out := generator.NewMemoryOutput()
+	c.Output = out
+	c.Verify = true
+	if err := c.ExecutePackages("/out", packages); err == nil {
+		t.Errorf("expected an error for the missing file")
+	}
+	results := c.VerifyResults()
+	if len(results) != 1 || results[0].Status != generator.VerifyMissing || results[0].Path != "example.com/out/names.go" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	out.WriteFile("/out/example.com/out/names.go", []byte("package out\n\nconst BlahName = \"Foo\"\n"))
+	c, packages = outputTestContext(t)
+	c.Output = out
+	c.Verify = true
+	err := c.ExecutePackages("/out", packages)
+	if err == nil {
+		t.Fatalf("expected an error for the stale file")
+	}
+	diff := `--- a/example.com/out/names.go
++++ b/example.com/out/names.go
+@@ -1,3 +1,3 @@
+ package out
+ 
+-const BlahName = "Foo"
++const BlahName = "Blah"
+`
+	results = c.VerifyResults()
+	if len(results) != 1 || results[0].Status != generator.VerifyStale {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if e, a := diff, string(c.VerifyPatch()); e != a {
+		t.Errorf("wanted patch:\n%s\ngot:\n%s", e, a)
+	}
+	if !strings.Contains(err.Error(), diff) {
+		t.Errorf("expected the error to include the diff, got: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// VerifyReport is a machine-readable summary of a verification, e.g. for CI
+// systems to annotate the files which need to be regenerated.
+type VerifyReport struct {
+	// True if every file is up to date.
+	OK       bool                  `json:"ok"`
+	Packages []VerifyPackageReport `json:"packages"`
+}
+
+// VerifyPackageReport lists the verified files of one package.
+type VerifyPackageReport struct {
+	Path  string             `json:"path"`
+	Files []VerifyFileReport `json:"files"`
+}
+
+// VerifyFileReport is the result of verifying one file.
+type VerifyFileReport struct {
+	// The path of the file relative to the output directory.
+	Path         string       `json:"path"`
+	Status       VerifyStatus `json:"status"`
+	Generators   []string     `json:"generators,omitempty"`
+	LinesAdded   int          `json:"linesAdded"`
+	LinesRemoved int          `json:"linesRemoved"`
+	Diff         string       `json:"diff,omitempty"`
+}
+
+// NewVerifyReport groups verification results by package. Packages and files
+// keep the order of 'results'.
+func NewVerifyReport(results []VerifyResult) *VerifyReport {
+	report := &VerifyReport{OK: true, Packages: []VerifyPackageReport{}}
+	index := map[string]int{}
+	for _, r := range results {
+		if !r.OK() {
+			report.OK = false
+		}
+		i, found := index[r.Package]
+		if !found {
+			i = len(report.Packages)
+			index[r.Package] = i
+			report.Packages = append(report.Packages, VerifyPackageReport{Path: r.Package})
+		}
+		report.Packages[i].Files = append(report.Packages[i].Files, VerifyFileReport{
+			Path:         r.Path,
+			Status:       r.Status,
+			Generators:   r.Generators,
+			LinesAdded:   r.LinesAdded,
+			LinesRemoved: r.LinesRemoved,
+			Diff:         r.Diff,
+		})
+	}
+	return report
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *VerifyReport) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML, with a test suite per package
+// and a test case per file. Files which are not up to date are failures,
+// carrying their diff.
+func (r *VerifyReport) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{}
+	for _, p := range r.Packages {
+		suite := junitTestSuite{Name: p.Path, Tests: len(p.Files)}
+		for _, f := range p.Files {
+			tc := junitTestCase{Name: f.Path, ClassName: p.Path}
+			if f.Status != VerifyUpToDate {
+				suite.Failures++
+				tc.Failure = &junitFailure{
+					Message: fmt.Sprintf("%s (+%d -%d)", f.Status, f.LinesAdded, f.LinesRemoved),
+					Type:    string(f.Status),
+					Text:    f.Diff,
+				}
+				if len(f.Generators) > 0 {
+					tc.Failure.Message += fmt.Sprintf(", generated by %v", f.Generators)
+				}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/gengo/generator"
+)
+
+func TestVerifyReport(t *testing.T) {
+	c, packages := outputTestContext(t)
+	out := generator.NewMemoryOutput()
+	out.WriteFile("/out/example.com/out/names.go", []byte("package out\n\nconst BlahName = \"Foo\"\n"))
+	c.Output = out
+	c.Verify = true
+	if err := c.ExecutePackages("/out", packages); err == nil {
+		t.Fatalf("expected a verification error")
+	}
+	report := generator.NewVerifyReport(c.VerifyResults())
+
+	buf := &bytes.Buffer{}
+	if err := report.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &generator.VerifyReport{}
+	if err := json.Unmarshal(buf.Bytes(), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report, decoded) {
+		t.Errorf("the JSON report doesn't round-trip:\n%s", buf.String())
+	}
+	if decoded.OK || len(decoded.Packages) != 1 || len(decoded.Packages[0].Files) != 1 {
+		t.Fatalf("unexpected report:\n%s", buf.String())
+	}
+	e := generator.VerifyFileReport{
+		Path:         "example.com/out/names.go",
+		Status:       generator.VerifyStale,
+		Generators:   []string{"names"},
+		LinesAdded:   1,
+		LinesRemoved: 1,
+		Diff:         decoded.Packages[0].Files[0].Diff,
+	}
+	if a := decoded.Packages[0].Files[0]; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted %+v, got %+v", e, a)
+	}
+
+	buf.Reset()
+	if err := report.WriteJUnit(buf); err != nil {
+		t.Fatal(err)
+	}
+	var suites struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suites   []struct {
+			Name  string `xml:"name,attr"`
+			Cases []struct {
+				Name    string `xml:"name,attr"`
+				Failure struct {
+					Type string `xml:"type,attr"`
+					Text string `xml:",chardata"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid JUnit XML: %v\n%s", err, buf.String())
+	}
+	if suites.Tests != 1 || suites.Failures != 1 || len(suites.Suites) != 1 || suites.Suites[0].Name != "example.com/out" {
+		t.Fatalf("unexpected JUnit report:\n%s", buf.String())
+	}
+	failure := suites.Suites[0].Cases[0].Failure
+	if failure.Type != "stale" || !strings.Contains(failure.Text, `+const BlahName = "Blah"`) {
+		t.Errorf("unexpected failure: %+v", failure)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// DefaultDiffContext is the default number of lines of context in diffs.
+const DefaultDiffContext = 3
+
+// WriteSummary counts the files written by a context.
+type WriteSummary struct {
+	// Files which were created, or whose content changed.
+	Written int
+	// Files which already had the generated content, and were left alone.
+	Unchanged int
+}
+
+// VerifyStatus is the outcome of verifying a file.
+type VerifyStatus string
+
+const (
+	// The file has the generated content.
+	VerifyUpToDate VerifyStatus = "up-to-date"
+	// The file exists, but its content differs from the generated one.
+	VerifyStale VerifyStatus = "stale"
+	// The file should exist, but doesn't.
+	VerifyMissing VerifyStatus = "missing"
+	// The file looks generated, but nothing generates it anymore.
+	VerifyOrphaned VerifyStatus = "orphaned"
+)
+
+// VerifyResult is the outcome of verifying a single file.
+type VerifyResult struct {
+	// The path of the file relative to the output directory, with forward
+	// slashes.
+	Path string
+	// The import path of the file's package.
+	Package string
+	// The names of the generators which produce the file.
+	Generators []string
+	Status     VerifyStatus
+	// For stale and missing files, a unified diff which brings the file up
+	// to date. It can be applied in the output directory with `patch -p1`
+	// or `git apply`.
+	Diff string
+	// The number of lines the diff adds and removes.
+	LinesAdded, LinesRemoved int
+}
+
+// OK returns whether the file needs no changes.
+func (r VerifyResult) OK() bool {
+	return r.Status == VerifyUpToDate
+}
+
+// executionResults collects what Execute* calls have done. It is shared by a
+// context and all the contexts derived from it.
+type executionResults struct {
+	lock     sync.Mutex
+	summary  WriteSummary
+	verified []VerifyResult
+
+	// The directories of the executed packages, and the paths of the files
+	// generated in them, to find orphans.
+	packageDirs map[string]bool
+	generated   map[string]bool
+
+	// What the manifest said about each package.
+	manifest []ManifestResult
+}
+
+func (r *executionResults) addWritten(written bool) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if written {
+		r.summary.Written++
+	} else {
+		r.summary.Unchanged++
+	}
+}
+
+func (r *executionResults) addVerified(result VerifyResult) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.verified = append(r.verified, result)
+}
+
+func (r *executionResults) addManifestResult(result ManifestResult) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.manifest = append(r.manifest, result)
+}
+
+func (r *executionResults) addPackageDir(dir string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.packageDirs == nil {
+		r.packageDirs = map[string]bool{}
+	}
+	r.packageDirs[dir] = true
+}
+
+func (r *executionResults) addGenerated(path string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.generated == nil {
+		r.generated = map[string]bool{}
+	}
+	r.generated[path] = true
+}
+
+// executed returns the directories of the packages executed so far, and a set
+// of the files generated.
+func (r *executionResults) executed() ([]string, map[string]bool) {
+	dirs := []string{}
+	generated := map[string]bool{}
+	if r == nil {
+		return dirs, generated
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for dir := range r.packageDirs {
+		dirs = append(dirs, dir)
+	}
+	for path := range r.generated {
+		generated[path] = true
+	}
+	return dirs, generated
+}
+
+// WriteSummary returns how many files the Execute* calls on this context have
+// written, and how many they left alone because their content was already up
+// to date. Files are not counted when verifying.
+func (c *Context) WriteSummary() WriteSummary {
+	if c.results == nil {
+		return WriteSummary{}
+	}
+	c.results.lock.Lock()
+	defer c.results.lock.Unlock()
+	return c.results.summary
+}
+
+// VerifyResults returns the results of verifying files with this context,
+// sorted by path. Only file types implementing FileRenderer are included.
+func (c *Context) VerifyResults() []VerifyResult {
+	if c.results == nil {
+		return nil
+	}
+	c.results.lock.Lock()
+	defer c.results.lock.Unlock()
+	out := append([]VerifyResult{}, c.results.verified...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// VerifyPatch returns a patch which brings all the stale and missing files
+// found while verifying up to date. It can be applied in the output directory
+// with `patch -p1` or `git apply`. It is empty if everything is up to date.
+func (c *Context) VerifyPatch() []byte {
+	b := &bytes.Buffer{}
+	for _, r := range c.VerifyResults() {
+		b.WriteString(r.Diff)
+	}
+	return b.Bytes()
+}
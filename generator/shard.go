@@ -0,0 +1,255 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/gengo/types"
+
+	"k8s.io/klog"
+)
+
+// ShardPolicy says when to split the output of a generator across several
+// files, or shards. The first shard is the generator's Filename, and holds
+// everything written by Init and Finalize; the others are named after it with
+// a number, e.g. zz_generated.deepcopy_1.go, and hold only code generated for
+// types. A generator can only be sharded if the code it generates for each
+// type is a complete set of declarations, which doesn't depend on the code
+// generated for other types being in the same file.
+//
+// The number of shards is the smallest power of two which keeps the number of
+// types, and the size of the code generated for them, under the limits on
+// average. Each type is assigned to a shard by a hash of its name, so that
+// adding or removing types doesn't move the others, and only the types of
+// about half the shards move when the number of shards changes.
+//
+// Shards which are no longer needed are removed (or reported, when verifying)
+// if they carry the context's GeneratedMarker or one of its OrphanMarkers.
+// Once sharding is turned off, only the context's Manifest tells that there
+// were shards, so without one they are left alone.
+type ShardPolicy struct {
+	// The maximum number of types per shard, or 0 for no limit.
+	MaxTypes int
+	// The maximum size, in bytes, of the code generated for the types of a
+	// shard, or 0 for no limit.
+	MaxBytes int
+}
+
+// ShardedGenerator is implemented by generators which choose how their output
+// is sharded, instead of using the context's Sharding. It is called after
+// Namers.
+type ShardedGenerator interface {
+	// ShardPolicy returns how to shard the generator's output, or nil to
+	// never shard it.
+	ShardPolicy(*Context) *ShardPolicy
+}
+
+// shards returns how many shards 'count' types whose code is 'size' bytes
+// long are split into.
+func (p *ShardPolicy) shards(count, size int) int {
+	n := 1
+	for (p.MaxTypes > 0 && count > n*p.MaxTypes) || (p.MaxBytes > 0 && size > n*p.MaxBytes) {
+		n *= 2
+	}
+	return n
+}
+
+// shardOf returns which of n shards the type goes to.
+func shardOf(t *types.Type, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(t.Name.String()))
+	return int(h.Sum32() % uint32(n))
+}
+
+// ShardName returns the name of the i'th shard of the file with the given
+// name, e.g. zz_generated.deepcopy_1.go, or foo_1_test.go for foo_test.go.
+func ShardName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	stem, suffix := splitShardName(name)
+	return stem + "_" + strconv.Itoa(i) + suffix
+}
+
+func splitShardName(name string) (stem, suffix string) {
+	suffix = filepath.Ext(name)
+	if strings.HasSuffix(name, "_test.go") {
+		suffix = "_test.go"
+	}
+	return strings.TrimSuffix(name, suffix), suffix
+}
+
+// isShardName returns whether name is that of a shard of 'first' other than
+// itself.
+func isShardName(first, name string) bool {
+	stem, suffix := splitShardName(first)
+	if !strings.HasPrefix(name, stem+"_") || !strings.HasSuffix(name, suffix) {
+		return false
+	}
+	i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, stem+"_"), suffix))
+	return err == nil && i > 0 && ShardName(first, i) == name
+}
+
+// shardPolicy returns how to shard the output of the generator, or nil.
+func (c *Context) shardPolicy(g Generator) *ShardPolicy {
+	if sg, ok := g.(ShardedGenerator); ok {
+		return sg.ShardPolicy(c)
+	}
+	return c.Sharding
+}
+
+// executeSharded is executeBody for generators whose output is sharded. 'f'
+// is the first shard; shard(name) returns the shard with the given name,
+// starting it if needed. Shards are only started once a type is assigned to
+// them. It returns the shards written to.
+func (c *Context) executeSharded(f *File, generator Generator, policy *ShardPolicy, shard func(name string) (*File, error)) ([]*File, error) {
+	// Generate the code for every type before assigning them to shards, to
+	// measure it.
+	var init, final bytes.Buffer
+	bodies := make([]bytes.Buffer, len(c.Order))
+	et := NewErrorTracker(&init)
+	if err := generator.Init(c, et); err != nil {
+		return nil, err
+	}
+	size := 0
+	for i, t := range c.Order {
+		if err := c.canceled(); err != nil {
+			return nil, err
+		}
+		et := NewErrorTracker(&bodies[i])
+		if err := generator.GenerateType(c, t, et); err != nil {
+			return nil, err
+		}
+		if err := et.Error(); err != nil {
+			return nil, err
+		}
+		size += bodies[i].Len()
+	}
+	et = NewErrorTracker(&final)
+	if err := generator.Finalize(c, et); err != nil {
+		return nil, err
+	}
+	if err := et.Error(); err != nil {
+		return nil, err
+	}
+
+	n := policy.shards(len(c.Order), size)
+	klog.V(5).Infof("Splitting the output of generator %q for %d types (%d bytes) across %d shards", generator.Name(), len(c.Order), size, n)
+	shards := make([]*File, n)
+	shards[0] = f
+	written := []*File{f}
+	write := func(f *File, t *types.Type, b []byte) {
+		if len(b) > 0 {
+			start := f.Body.Len()
+			f.Body.Write(b)
+			f.Sections = append(f.Sections, Section{Generator: generator.Name(), Type: t, Start: start, End: f.Body.Len()})
+		}
+	}
+	write(f, nil, init.Bytes())
+	for i, t := range c.Order {
+		if bodies[i].Len() == 0 {
+			continue
+		}
+		j := shardOf(t, n)
+		if shards[j] == nil {
+			s, err := shard(ShardName(f.Name, j))
+			if err != nil {
+				return nil, err
+			}
+			shards[j] = s
+			written = append(written, s)
+		}
+		write(shards[j], t, bodies[i].Bytes())
+	}
+	write(f, nil, final.Bytes())
+	return written, nil
+}
+
+// removeStaleShards removes (or, when verifying, reports) the shards of the
+// given files which were not generated, because fewer shards are needed than
+// before.
+func (c *Context) removeStaleShards(outDir string, files []*File) error {
+	out, ok := c.output().(DirOutput)
+	if !ok {
+		return nil
+	}
+	// The first shards of each directory.
+	firsts := map[string][]string{}
+	for _, f := range files {
+		if f.ShardOf != "" {
+			dir := filepath.Join(outDir, f.PackagePath)
+			firsts[dir] = append(firsts[dir], f.ShardOf)
+		}
+	}
+	dirs := []string{}
+	for dir := range firsts {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	markers := c.OrphanMarkers
+	if c.GeneratedMarker != "" {
+		markers = append(append([]string{}, markers...), c.GeneratedMarker)
+	}
+	_, generated := c.results.executed()
+	var errors []string
+	for _, dir := range dirs {
+		names, err := out.ReadDir(dir)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("unable to list %q: %v", dir, err))
+			continue
+		}
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if generated[path] || !isShardOfAny(firsts[dir], name) {
+				continue
+			}
+			content, err := out.ReadFile(path)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("unable to read %q: %v", path, err))
+				continue
+			}
+			if !hasMarker(content, markers) {
+				klog.Warningf("Not removing %q: it is named like a shard, but doesn't have a generated-code marker", path)
+				continue
+			}
+			if err := c.orphaned(out, outDir, path, content); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("stale shards:\n%v", strings.Join(errors, "\n"))
+	}
+	return nil
+}
+
+func isShardOfAny(firsts []string, name string) bool {
+	for _, first := range firsts {
+		if isShardName(first, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/gengo/generator"
+)
+
+// shardTestContext returns a context with count structs in base/foo, and a
+// package which generates a constant for each of them, in marked files.
+func shardTestContext(t *testing.T, count int) (*generator.Context, generator.Packages) {
+	src := "package foo\n"
+	for i := 0; i < count; i++ {
+		src += fmt.Sprintf("\ntype T%d struct{}\n", i)
+	}
+	c := construct(t, map[string]string{"base/foo/foo.go": src})
+	c.GeneratedMarker = "// Code generated by"
+	packages := generator.Packages{&generator.DefaultPackage{
+		PackageName:   "out",
+		PackagePath:   "example.com/out",
+		HeaderText:    []byte("// Code generated by test. DO NOT EDIT.\n\n"),
+		GeneratorList: []generator.Generator{&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "names"}}},
+	}}
+	return c, packages
+}
+
+func TestSharding(t *testing.T) {
+	out := generator.NewMemoryOutput()
+	manifest := generator.NewManifest()
+	run := func(count int, policy *generator.ShardPolicy, verify bool, m *generator.Manifest) (map[string]string, error) {
+		c, packages := shardTestContext(t, count)
+		c.Output = out
+		c.Sharding = policy
+		c.Verify = verify
+		c.Manifest = m
+		c.GeneratorSettings = fmt.Sprintf("%+v", policy)
+		err := c.ExecutePackages("/out", packages)
+		// Which file declares each type's constant.
+		where := map[string]string{}
+		for _, path := range out.Files() {
+			content, _ := out.ReadFile(path)
+			for _, line := range strings.Split(string(content), "\n") {
+				if strings.HasPrefix(line, "const ") {
+					where[strings.Fields(line)[1]] = filepath.Base(path)
+				}
+			}
+		}
+		return where, err
+	}
+
+	where, err := run(20, &generator.ShardPolicy{MaxTypes: 4}, false, manifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(where) != 20 {
+		t.Fatalf("expected 20 constants, got %v", where)
+	}
+	shards := map[string]bool{}
+	for _, name := range where {
+		shards[name] = true
+	}
+	if len(shards) < 2 || len(out.Files()) > 8 {
+		t.Errorf("expected the types to be spread over at most 8 shards, got %v", out.Files())
+	}
+
+	// Adding a type doesn't move the others.
+	more, err := run(21, &generator.ShardPolicy{MaxTypes: 4}, false, manifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, file := range where {
+		if more[name] != file {
+			t.Errorf("%s moved from %s to %s", name, file, more[name])
+		}
+	}
+
+	sharded := out.Files()
+
+	// Without a manifest, there is no telling that the output was sharded.
+	if _, err := run(21, nil, false, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := sharded, out.Files(); !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted files %v, got %v", e, a)
+	}
+
+	// Shards which are no longer needed are reported, then removed.
+	if _, err := run(21, nil, true, manifest); err == nil || !strings.Contains(err.Error(), "no longer generated") {
+		t.Errorf("expected the stale shards to be reported, got %v", err)
+	}
+	where, err = run(21, nil, false, manifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := []string{"/out/example.com/out/names.go"}, out.Files(); !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted files %v, got %v", e, a)
+	}
+	if len(where) != 21 {
+		t.Errorf("expected 21 constants, got %v", where)
+	}
+}
@@ -103,17 +103,28 @@ func (s *SnippetWriter) Do(format string, args interface{}) *SnippetWriter {
 	// Name the template by source file:line so it can be found when
 	// there's an error.
 	_, file, line, _ := runtime.Caller(1)
-	tmpl, err := template.
-		New(fmt.Sprintf("%s:%d", file, line)).
-		Delims(s.left, s.right).
-		Funcs(s.funcMap).
-		Parse(format)
+	tmpl, err := s.Template(fmt.Sprintf("%s:%d", file, line), format)
 	if err != nil {
 		s.err = err
 		return s
 	}
-	err = tmpl.Execute(s.w, args)
-	if err != nil {
+	return s.Execute(tmpl, args)
+}
+
+// Template parses format as Do would, with the writer's delimiters and a
+// function for every naming system, but names the template 'name' for errors.
+// Use it with Execute to parse a long template, such as a file, only once.
+func (s *SnippetWriter) Template(name, format string) (*template.Template, error) {
+	return template.New(name).Delims(s.left, s.right).Funcs(s.funcMap).Parse(format)
+}
+
+// Execute runs args through a template returned by Template. Like Do, it is
+// chainable, and any error is returned by Error().
+func (s *SnippetWriter) Execute(tmpl *template.Template, args interface{}) *SnippetWriter {
+	if s.err != nil {
+		return s
+	}
+	if err := tmpl.Execute(s.w, args); err != nil {
 		s.err = err
 	}
 	return s
@@ -0,0 +1,227 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SourceMapMode is how generated Go files are mapped back to what produced
+// them.
+type SourceMapMode string
+
+const (
+	// No source mapping.
+	SourceMapNone SourceMapMode = ""
+	// Each part of a file written by a generator for a type is preceded by
+	// a comment of the form
+	//
+	//	//gengo:source ../types.go:42:6 generator=deepcopy type=k8s.io/api/core/v1.Pod
+	//
+	// giving the position of the type relative to the file. (Unlike a
+	// //line directive, this doesn't change the positions the compiler
+	// reports errors at.)
+	SourceMapComments SourceMapMode = "comments"
+	// Each file is accompanied by a JSON SourceMap, named after the file
+	// with a ".map.json" suffix.
+	SourceMapJSON SourceMapMode = "json"
+)
+
+// SourceMapVersion identifies the format of SourceMap files.
+const SourceMapVersion = "gengo/sourcemap/v1"
+
+// SourceMap maps the parts of a generated file to the generator calls which
+// wrote them, and the input types they were written for.
+type SourceMap struct {
+	Version  string             `json:"version"`
+	File     string             `json:"file"`
+	Sections []SourceMapSection `json:"sections"`
+}
+
+// SourceMapSection is a part of a generated file written by a single call to a
+// generator.
+type SourceMapSection struct {
+	Generator string `json:"generator"`
+	// The type passed to GenerateType; empty for Init and Finalize.
+	Type string `json:"type,omitempty"`
+	// Where the type is declared, relative to the generated file's
+	// directory, if it was parsed from source.
+	Source *SourcePosition `json:"source,omitempty"`
+	// The byte range of the section in the file, and its first and last
+	// lines (from 1).
+	Start     int `json:"start"`
+	End       int `json:"end"`
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// SourcePosition is a position in an input file.
+type SourcePosition struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column,omitempty"`
+}
+
+func (p *SourcePosition) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+const sectionMarker = "//gengo:section:"
+
+// sourceMapRenderer renders files with their source map.
+type sourceMapRenderer struct {
+	FileRenderer
+	mode SourceMapMode
+	// The directory the file is written to.
+	dir string
+	// Set by RenderFile.
+	sourceMap *SourceMap
+}
+
+// RenderFile marks where each section of the body starts with a comment,
+// renders the file, then turns the marks into annotations, or removes them and
+// records their positions in the source map.
+func (r *sourceMapRenderer) RenderFile(f *File) ([]byte, error) {
+	marked := *f
+	marked.Body = bytes.Buffer{}
+	body := f.Body.Bytes()
+	last := 0
+	sections := []Section{}
+	for _, s := range f.Sections {
+		// Empty sections are left out, and a section which doesn't start on
+		// a line of its own is part of the previous one.
+		if s.End == s.Start || s.Start > 0 && body[s.Start-1] != '\n' {
+			continue
+		}
+		marked.Body.Write(body[last:s.Start])
+		fmt.Fprintf(&marked.Body, "%s%d\n", sectionMarker, len(sections))
+		sections = append(sections, s)
+		last = s.Start
+	}
+	marked.Body.Write(body[last:])
+
+	content, err := r.FileRenderer.RenderFile(&marked)
+	if err != nil {
+		// Render without the marks.
+		return r.FileRenderer.RenderFile(f)
+	}
+
+	r.sourceMap = &SourceMap{Version: SourceMapVersion, File: f.Name, Sections: []SourceMapSection{}}
+	out := &bytes.Buffer{}
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	var current *SourceMapSection
+	line := 0
+	for _, l := range lines {
+		if len(l) == 0 {
+			continue
+		}
+		trimmed := strings.TrimSpace(string(l))
+		if strings.HasPrefix(trimmed, sectionMarker) {
+			i, err := strconv.Atoi(strings.TrimPrefix(trimmed, sectionMarker))
+			if err != nil || i < 0 || i >= len(sections) {
+				return nil, fmt.Errorf("unexpected source map mark %q in %q", trimmed, f.Name)
+			}
+			if current != nil {
+				r.sourceMap.Sections = append(r.sourceMap.Sections, *current)
+			}
+			current = r.section(sections[i])
+			if r.mode == SourceMapComments {
+				indent := l[:len(l)-len(bytes.TrimLeft(l, " \t"))]
+				out.Write(indent)
+				out.WriteString(annotation(current))
+				out.WriteString("\n")
+				line++
+			}
+			current.Start, current.StartLine = out.Len(), line+1
+			continue
+		}
+		out.Write(l)
+		line++
+		if current != nil {
+			current.End, current.EndLine = out.Len(), line
+		}
+	}
+	if current != nil {
+		r.sourceMap.Sections = append(r.sourceMap.Sections, *current)
+	}
+	return out.Bytes(), nil
+}
+
+// section describes s in the source map, without its position in the file.
+func (r *sourceMapRenderer) section(s Section) *SourceMapSection {
+	out := &SourceMapSection{Generator: s.Generator}
+	if s.Type == nil {
+		return out
+	}
+	out.Type = s.Type.String()
+	if p := s.Type.Position; p.IsValid() {
+		file := p.Filename
+		if rel, err := filepath.Rel(r.dir, file); err == nil {
+			file = rel
+		}
+		out.Source = &SourcePosition{File: filepath.ToSlash(file), Line: p.Line, Column: p.Column}
+	}
+	return out
+}
+
+func annotation(s *SourceMapSection) string {
+	b := &strings.Builder{}
+	b.WriteString("//gengo:source")
+	if s.Source != nil {
+		fmt.Fprintf(b, " %v", s.Source)
+	}
+	fmt.Fprintf(b, " generator=%s", s.Generator)
+	if s.Type != "" {
+		fmt.Fprintf(b, " type=%s", s.Type)
+	}
+	return b.String()
+}
+
+// sourceMapFile renders the source map of a file as JSON.
+type sourceMapFile struct {
+	sourceMap *SourceMap
+}
+
+func (r sourceMapFile) RenderFile(f *File) ([]byte, error) {
+	data, err := json.MarshalIndent(r.sourceMap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// sourceMapOf returns the file which holds the source map of f, next to it.
+// Its content is rendered by sourceMapFile.
+func sourceMapOf(f *File) *File {
+	return &File{
+		Name:        f.Name + ".map.json",
+		PackageName: f.PackageName,
+		PackagePath: f.PackagePath,
+		Generators:  f.Generators,
+	}
+}
+
+// hasSourceMap returns whether a source map is written next to f.
+func (c *Context) hasSourceMap(f *File) bool {
+	_, ok := c.FileTypes[f.FileType].(FileRenderer)
+	return ok && c.SourceMap == SourceMapJSON && strings.HasSuffix(f.Name, ".go")
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/gengo/generator"
+)
+
+// sourceMapTestContext returns a context mapping its output in the given mode,
+// and a package which generates a constant for the one struct in base/foo.
+func sourceMapTestContext(t *testing.T, mode generator.SourceMapMode) (*generator.Context, generator.Packages) {
+	c := construct(t, map[string]string{
+		"base/foo/foo.go": `
+package foo
+
+type Blah struct{}
+`,
+	})
+	c.SourceMap = mode
+	packages := generator.Packages{&generator.DefaultPackage{
+		PackageName:   "out",
+		PackagePath:   "example.com/out",
+		GeneratorList: []generator.Generator{&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "names"}}},
+	}}
+	return c, packages
+}
+
+func TestSourceMap(t *testing.T) {
+	c, packages := sourceMapTestContext(t, generator.SourceMapComments)
+	out := generator.NewMemoryOutput()
+	c.Output = out
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ := out.ReadFile("/out/example.com/out/names.go")
+	e := "package out\n\n//gengo:source base/foo/foo.go:4:6 generator=names type=/tmp/base/foo/foo.go.Blah\nconst BlahName = \"Blah\"\n"
+	if a := string(content); e != a {
+		t.Errorf("wanted:\n%s\ngot:\n%s", e, a)
+	}
+
+	c, packages = sourceMapTestContext(t, generator.SourceMapJSON)
+	out = generator.NewMemoryOutput()
+	c.Output = out
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ = out.ReadFile("/out/example.com/out/names.go")
+	if e, a := "package out\n\nconst BlahName = \"Blah\"\n", string(content); e != a {
+		t.Errorf("wanted:\n%s\ngot:\n%s", e, a)
+	}
+	data, err := out.ReadFile("/out/example.com/out/names.go.map.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &generator.SourceMap{}
+	if err := json.Unmarshal(data, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Sections) != 1 {
+		t.Fatalf("expected one section, got %+v", m.Sections)
+	}
+	s := m.Sections[0]
+	if s.Generator != "names" || s.Type != "/tmp/base/foo/foo.go.Blah" || s.Source == nil || s.Source.Line != 4 {
+		t.Errorf("unexpected section: %+v", s)
+	}
+	if e, a := "const BlahName = \"Blah\"\n", string(content[s.Start:s.End]); e != a || s.StartLine != 3 || s.EndLine != 3 {
+		t.Errorf("section covers %q, lines %d-%d", a, s.StartLine, s.EndLine)
+	}
+
+	// The source map is written, verified and recorded like any other file.
+	c, packages = sourceMapTestContext(t, generator.SourceMapJSON)
+	c.Output = out
+	c.Manifest = generator.NewManifest()
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := (generator.WriteSummary{Unchanged: 2}), c.WriteSummary(); e != a {
+		t.Errorf("wanted %+v, got %+v", e, a)
+	}
+	if files := c.Manifest.Outputs[0].Files; len(files) != 2 || files[1].Name != "names.go.map.json" {
+		t.Errorf("unexpected files in the manifest: %+v", files)
+	}
+
+	out.WriteFile("/out/example.com/out/names.go.map.json", []byte("{}\n"))
+	c, packages = sourceMapTestContext(t, generator.SourceMapJSON)
+	c.Output = out
+	c.Verify = true
+	if err := c.ExecutePackages("/out", packages); err == nil {
+		t.Errorf("expected the stale source map to be reported")
+	}
+	results := c.VerifyResults()
+	if len(results) != 2 || results[0].Status != generator.VerifyUpToDate || results[1].Path != "example.com/out/names.go.map.json" || results[1].Status != generator.VerifyStale {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
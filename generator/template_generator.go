@@ -0,0 +1,407 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/types"
+)
+
+// TemplateConfig configures generators which render a text/template template
+// for each of the types they select, so that simple generators can be written
+// without any Go code. It is usually read from a JSON file, e.g.
+//
+//	{
+//		"templates": [{
+//			"template": "stringer.tmpl",
+//			"kinds": ["Struct"],
+//			"tag": "gen-stringer",
+//			"output": "zz_generated.stringer.go"
+//		}]
+//	}
+//
+// where stringer.tmpl might be
+//
+//	func (x $.Type|raw$) String() string {
+//		return "$.Type.Name.Name$"
+//	}
+//
+// Templates use SnippetWriter's conventions: "$" delimits actions, and every
+// naming system is a function taking a type. Each template is run with a
+// TemplateData. See TemplateConfig.Packages.
+type TemplateConfig struct {
+	Templates []TemplateSpec `json:"templates"`
+
+	// The delimiters of actions in the templates and output file names.
+	// Both default to "$".
+	LeftDelim  string `json:"leftDelim,omitempty"`
+	RightDelim string `json:"rightDelim,omitempty"`
+}
+
+// TemplateSpec says which types to render a template for, and where.
+type TemplateSpec struct {
+	// The name of the generator. Defaults to the base name of Template,
+	// without its extension.
+	Name string `json:"name,omitempty"`
+
+	// The path of the template, relative to the configuration file.
+	Template string `json:"template,omitempty"`
+	// The template itself, if Template is not set. ReadTemplateConfig sets
+	// this from Template.
+	Text string `json:"text,omitempty"`
+
+	// If set, only types of these kinds (e.g. "Struct" or "Alias") are
+	// selected.
+	Kinds []string `json:"kinds,omitempty"`
+	// If set, only types with this comment tag are selected, e.g.
+	// "gen-stringer" for types with a "+gen-stringer" comment. If TagValue
+	// is also set, the tag must have that value, as in
+	// "+gen-stringer=true".
+	Tag      string `json:"tag,omitempty"`
+	TagValue string `json:"tagValue,omitempty"`
+	// If set, only types in packages matching one of these patterns are
+	// selected. A pattern ending in "/..." matches the package and those
+	// below it; others are matched with path.Match. Only types in the input
+	// packages are ever selected.
+	Packages []string `json:"packages,omitempty"`
+
+	// The name of the file each type is rendered to. It is a template, with
+	// the same delimiters, run with the type's TemplateData; types whose
+	// file names are the same share the file. Defaults to
+	// "zz_generated.<name>.go".
+	Output string `json:"output,omitempty"`
+	// The path of the package to write to. Defaults to the package of each
+	// type.
+	OutputPackage string `json:"outputPackage,omitempty"`
+
+	// The naming systems to add as template functions, among "public",
+	// "private", "raw", "publicPlural", "privatePlural" and
+	// "lowercasePlural". Defaults to "public", "private" and "raw". The
+	// "raw" namer qualifies types outside the output package, and imports
+	// their packages.
+	Namers []string `json:"namers,omitempty"`
+	// Additional imports of the generated files, in the form returned by
+	// Generator.Imports. Unused imports are removed.
+	Imports []string `json:"imports,omitempty"`
+}
+
+// TemplateData is what templates, and output file names, are run with.
+type TemplateData struct {
+	// The selected type.
+	Type *types.Type
+	// The comment tags of the type, e.g. {"gen-stringer": ["true"]} for a
+	// type with a "+gen-stringer=true" comment.
+	Tags map[string][]string
+	// The name and path of the package being generated.
+	Package     string
+	PackagePath string
+}
+
+var templateNamers = map[string]func(pkg string, tracker namer.ImportTracker) namer.Namer{
+	"public":          func(string, namer.ImportTracker) namer.Namer { return namer.NewPublicNamer(0) },
+	"private":         func(string, namer.ImportTracker) namer.Namer { return namer.NewPrivateNamer(0) },
+	"raw":             func(pkg string, tracker namer.ImportTracker) namer.Namer { return namer.NewRawNamer(pkg, tracker) },
+	"publicPlural":    func(string, namer.ImportTracker) namer.Namer { return namer.NewPublicPluralNamer(nil) },
+	"privatePlural":   func(string, namer.ImportTracker) namer.Namer { return namer.NewPrivatePluralNamer(nil) },
+	"lowercasePlural": func(string, namer.ImportTracker) namer.Namer { return namer.NewAllLowercasePluralNamer(nil) },
+}
+
+var defaultTemplateNamers = []string{"public", "private", "raw"}
+
+// ReadTemplateConfig reads a TemplateConfig from a JSON file, and the templates
+// it refers to, relative to it.
+func ReadTemplateConfig(configPath string) (*TemplateConfig, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &TemplateConfig{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse template configuration %q: %v", configPath, err)
+	}
+	for i := range cfg.Templates {
+		spec := &cfg.Templates[i]
+		if spec.Template == "" {
+			continue
+		}
+		file := spec.Template
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(configPath), file)
+		}
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read template %q: %v", spec.Template, err)
+		}
+		spec.Text = string(text)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid template configuration %q: %v", configPath, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks that every template has a name, is known, and parses.
+func (cfg *TemplateConfig) Validate() error {
+	left, right := cfg.delims()
+	names := map[string]bool{}
+	for i := range cfg.Templates {
+		spec := &cfg.Templates[i]
+		name := spec.name()
+		if name == "" {
+			return fmt.Errorf("template %d has no name", i)
+		}
+		if names[name] {
+			return fmt.Errorf("there are several templates named %q", name)
+		}
+		names[name] = true
+		if spec.Text == "" {
+			return fmt.Errorf("template %q is empty", name)
+		}
+		funcs := template.FuncMap{}
+		for _, n := range spec.namers() {
+			if templateNamers[n] == nil {
+				return fmt.Errorf("template %q uses an unknown naming system %q", name, n)
+			}
+		}
+		// Check the syntax, with every naming system a template could be
+		// given.
+		for n := range templateNamers {
+			funcs[n] = func(*types.Type) string { return "" }
+		}
+		if _, err := template.New(name).Delims(left, right).Funcs(funcs).Parse(spec.Text); err != nil {
+			return err
+		}
+		if _, err := template.New(name).Delims(left, right).Funcs(funcs).Parse(spec.output()); err != nil {
+			return fmt.Errorf("template %q has an invalid output file name: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *TemplateConfig) delims() (left, right string) {
+	left, right = cfg.LeftDelim, cfg.RightDelim
+	if left == "" {
+		left = "$"
+	}
+	if right == "" {
+		right = "$"
+	}
+	return left, right
+}
+
+func (spec *TemplateSpec) name() string {
+	if spec.Name != "" || spec.Template == "" {
+		return spec.Name
+	}
+	base := filepath.Base(spec.Template)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func (spec *TemplateSpec) output() string {
+	if spec.Output != "" {
+		return spec.Output
+	}
+	return "zz_generated." + spec.name() + ".go"
+}
+
+func (spec *TemplateSpec) namers() []string {
+	if len(spec.Namers) == 0 {
+		return defaultTemplateNamers
+	}
+	return spec.Namers
+}
+
+// selects returns whether the template is rendered for the type.
+func (spec *TemplateSpec) selects(t *types.Type, tags map[string][]string) bool {
+	if len(spec.Kinds) > 0 && !containsString(spec.Kinds, string(t.Kind)) {
+		return false
+	}
+	if spec.Tag != "" {
+		values, found := tags[spec.Tag]
+		if !found || (spec.TagValue != "" && !containsString(values, spec.TagValue)) {
+			return false
+		}
+	}
+	if len(spec.Packages) == 0 {
+		return true
+	}
+	for _, pattern := range spec.Packages {
+		if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern {
+			if t.Name.Package == prefix || strings.HasPrefix(t.Name.Package, prefix+"/") {
+				return true
+			}
+		} else if matched, _ := path.Match(pattern, t.Name.Package); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Packages returns the packages to generate: for each template, the types of
+// the context's inputs it selects are grouped by output package and file name,
+// and each group is rendered by a generator. Every file starts with 'header'.
+func (cfg *TemplateConfig) Packages(c *Context, header []byte) (Packages, error) {
+	left, right := cfg.delims()
+	inputs := append([]string{}, c.Inputs...)
+	sort.Strings(inputs)
+
+	packages := map[string]*DefaultPackage{}
+	order := []string{}
+	generators := map[string]*templateGen{}
+	for i := range cfg.Templates {
+		spec := &cfg.Templates[i]
+		for _, input := range inputs {
+			pkg := c.Universe.Package(input)
+			names := []string{}
+			for name := range pkg.Types {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				t := pkg.Types[name]
+				comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+				tags := types.ExtractCommentTags("+", comments)
+				if !spec.selects(t, tags) {
+					continue
+				}
+
+				outPath, outName := pkg.Path, pkg.Name
+				if spec.OutputPackage != "" && spec.OutputPackage != pkg.Path {
+					outPath = spec.OutputPackage
+					outName = strings.Split(path.Base(outPath), ".")[0]
+					if p := c.Universe[outPath]; p != nil && p.Name != "" {
+						outName = p.Name
+					}
+				}
+				data := &TemplateData{Type: t, Tags: tags, Package: outName, PackagePath: outPath}
+				// File names may use every naming system, but don't import
+				// anything.
+				namers := namer.NameSystems{}
+				for n, newNamer := range templateNamers {
+					namers[n] = newNamer(outPath, nil)
+				}
+				buf := &bytes.Buffer{}
+				if err := NewSnippetWriter(buf, &Context{Namers: namers}, left, right).Do(spec.output(), data).Error(); err != nil {
+					return nil, fmt.Errorf("unable to name the output of template %q for type %v: %v", spec.name(), t, err)
+				}
+				filename := buf.String()
+				if filename == "" || strings.ContainsAny(filename, "/\\") {
+					return nil, fmt.Errorf("template %q names its output for type %v %q, which is not a file name", spec.name(), t, filename)
+				}
+
+				p := packages[outPath]
+				if p == nil {
+					p = &DefaultPackage{PackageName: outName, PackagePath: outPath, HeaderText: header}
+					if outPath == pkg.Path {
+						p.Source = pkg.SourcePath
+					}
+					packages[outPath] = p
+					order = append(order, outPath)
+				}
+				key := spec.name() + "\x00" + outPath + "\x00" + filename
+				g := generators[key]
+				if g == nil {
+					g = &templateGen{
+						DefaultGen:    DefaultGen{OptionalName: spec.name()},
+						spec:          spec,
+						left:          left,
+						right:         right,
+						filename:      filename,
+						outputPackage: outPath,
+						types:         map[*types.Type]*TemplateData{},
+					}
+					generators[key] = g
+					p.GeneratorList = append(p.GeneratorList, g)
+				}
+				g.types[t] = data
+			}
+		}
+	}
+
+	out := Packages{}
+	for _, outPath := range order {
+		out = append(out, packages[outPath])
+	}
+	return out, nil
+}
+
+// templateGen renders a template for each of its types.
+type templateGen struct {
+	DefaultGen
+	spec          *TemplateSpec
+	left, right   string
+	filename      string
+	outputPackage string
+	types         map[*types.Type]*TemplateData
+
+	// Set by Init.
+	tmpl *template.Template
+}
+
+func (g *templateGen) Filename() string { return g.filename }
+
+func (g *templateGen) Filter(c *Context, t *types.Type) bool {
+	return g.types[t] != nil
+}
+
+func (g *templateGen) Namers(c *Context) namer.NameSystems {
+	namers := namer.NameSystems{}
+	for _, n := range g.spec.namers() {
+		namers[n] = templateNamers[n](g.outputPackage, c.FileImports())
+	}
+	return namers
+}
+
+func (g *templateGen) Imports(c *Context) []string {
+	return g.spec.Imports
+}
+
+func (g *templateGen) Init(c *Context, w io.Writer) error {
+	tmpl, err := NewSnippetWriter(w, c, g.left, g.right).Template(g.spec.name(), g.spec.Text)
+	if err != nil {
+		return err
+	}
+	g.tmpl = tmpl
+	return nil
+}
+
+func (g *templateGen) GenerateType(c *Context, t *types.Type, w io.Writer) error {
+	if err := NewSnippetWriter(w, c, g.left, g.right).Execute(g.tmpl, g.types[t]).Error(); err != nil {
+		return fmt.Errorf("unable to render template %q for type %v: %v", g.spec.name(), t, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/parser"
+)
+
+func TestTemplateConfig(t *testing.T) {
+	b := parser.New()
+	src := `package in
+
+// +gen-lister
+type Widget struct{}
+
+// +gen-lister=false
+type Gadget struct{}
+
+type Other struct{}
+
+// +gen-lister
+type Color string
+`
+	if err := b.AddFileForTest("example.com/in", "/tmp/in/in.go", []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	c, err := generator.NewContext(b, namer.NameSystems{"public": namer.NewPublicNamer(0)}, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := generator.NewMemoryOutput()
+	c.Output = out
+
+	config := &generator.TemplateConfig{
+		LeftDelim:  "{{",
+		RightDelim: "}}",
+		Templates: []generator.TemplateSpec{{
+			Name:          "lister",
+			Text:          "type {{.Type|public}}List []{{.Type|raw}} // {{index .Tags \"gen-lister\"}}\n",
+			Kinds:         []string{"Struct"},
+			Tag:           "gen-lister",
+			Packages:      []string{"example.com/..."},
+			Output:        "{{.Type|lowercasePlural}}.go",
+			OutputPackage: "example.com/out",
+			Namers:        []string{"public", "raw", "lowercasePlural"},
+		}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	packages, err := config.Packages(c, []byte("// Code generated by test. DO NOT EDIT.\n\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := []string{"/out/example.com/out/gadgets.go", "/out/example.com/out/widgets.go"}, out.Files(); !reflect.DeepEqual(e, a) {
+		t.Fatalf("wanted files %v, got %v", e, a)
+	}
+	content, _ := out.ReadFile("/out/example.com/out/widgets.go")
+	e := `// Code generated by test. DO NOT EDIT.
+
+package out
+
+import (
+	in "example.com/in"
+)
+
+type WidgetList []in.Widget // []
+`
+	if a := string(content); e != a {
+		t.Errorf("wanted:\n%s\ngot:\n%s", e, a)
+	}
+
+	// Only "+gen-lister=false" types, in the types' own package.
+	config.Templates[0].TagValue = "false"
+	config.Templates[0].OutputPackage = ""
+	config.Templates[0].Output = ""
+	packages, err = config.Packages(c, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.ExecutePackages("/out", packages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ = out.ReadFile("/out/example.com/in/zz_generated.lister.go")
+	if e, a := "package in\n\ntype GadgetList []Gadget // [false]\n", string(content); e != a {
+		t.Errorf("wanted:\n%s\ngot:\n%s", e, a)
+	}
+
+	for _, spec := range []generator.TemplateSpec{
+		{Name: "empty"},
+		{Name: "namer", Text: "x", Namers: []string{"unknown"}},
+		{Name: "syntax", Text: "{{.Type"},
+	} {
+		bad := &generator.TemplateConfig{LeftDelim: "{{", RightDelim: "}}", Templates: []generator.TemplateSpec{spec}}
+		if err := bad.Validate(); err == nil || !strings.Contains(err.Error(), spec.Name) {
+			t.Errorf("expected an error for %q, got %v", spec.Name, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// typeCheck type-checks the Go files generated for p along with the existing
+// sources of the package, and returns an error listing what doesn't compile,
+// with the generator and type which wrote each offending line.
+func (c *Context) typeCheck(outDir string, p Package, files []*File) error {
+	if c.builder == nil {
+		return fmt.Errorf("package %q can't be type-checked: %v", p.Path(), errNoBuilder)
+	}
+	// The files are checked before formatting, so that positions can be
+	// mapped back to their bodies.
+	sources := map[string][]byte{}
+	byName := map[string]*File{}
+	for _, f := range files {
+		ft := goFileType(c.FileTypes[f.FileType])
+		if ft == nil || !strings.HasSuffix(f.Name, ".go") {
+			continue
+		}
+		b := &bytes.Buffer{}
+		ft.Assemble(b, f)
+		// Formatting may add imports the generators didn't declare (see
+		// NewGolangFile), which have to be there too.
+		if added := addedImports(ft, f, b.Bytes()); len(added) > 0 {
+			withImports := *f
+			withImports.Imports = map[string]struct{}{}
+			for _, imports := range []map[string]struct{}{f.Imports, added} {
+				for i := range imports {
+					withImports.Imports[i] = struct{}{}
+				}
+			}
+			b.Reset()
+			ft.Assemble(b, &withImports)
+		}
+		sources[f.Name] = b.Bytes()
+		byName[f.Name] = f
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	dir := filepath.Join(outDir, p.Path())
+	errs, err := c.builder.CheckFiles(p.Path(), dir, sources)
+	if err != nil {
+		return fmt.Errorf("unable to type-check package %q: %v", p.Path(), err)
+	}
+	messages := []string{}
+	for _, e := range errs {
+		pos := e.Fset.Position(e.Pos)
+		f := byName[filepath.Base(pos.Filename)]
+		if f != nil && filepath.Dir(pos.Filename) == dir {
+			// Unused imports are removed when formatting.
+			if strings.Contains(e.Msg, "imported and not used") {
+				continue
+			}
+			messages = append(messages, fmt.Sprintf("%s:%d:%d: %s%s", filepath.Join(f.PackagePath, f.Name), pos.Line, pos.Column, e.Msg, origin(f, sources[f.Name], pos.Offset)))
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("%v: %s", pos, e.Msg))
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return fmt.Errorf("generated code for package %q does not compile:\n%s", p.Path(), strings.Join(messages, "\n"))
+}
+
+// goFileType returns the file type, which assembles Go files before
+// formatting them, or nil if it is not a DefaultFileType.
+func goFileType(ft FileType) *DefaultFileType {
+	switch ft := ft.(type) {
+	case *DefaultFileType:
+		return ft
+	case DefaultFileType:
+		return &ft
+	}
+	return nil
+}
+
+// addedImports returns the import lines which formatting the file's assembled
+// source 'src' adds, in the form of File.Imports. Nothing is returned if it
+// can't be formatted.
+func addedImports(ft *DefaultFileType, f *File, src []byte) map[string]struct{} {
+	formatted, err := ft.Format(src)
+	if err != nil {
+		return nil
+	}
+	parsed, err := parser.ParseFile(token.NewFileSet(), f.Name, formatted, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	added := map[string]struct{}{}
+	for _, spec := range parsed.Imports {
+		line, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if spec.Name != nil {
+			line = spec.Name.Name + " " + spec.Path.Value
+		}
+		if _, found := f.Imports[line]; !found {
+			added[line] = struct{}{}
+		}
+	}
+	return added
+}
+
+// origin describes what wrote the given offset of the file's assembled source
+// 'src', e.g. ` (from generator "deepcopy" for type k8s.io/api/core/v1.Pod)`.
+func origin(f *File, src []byte, offset int) string {
+	body := f.Body.Bytes()
+	start := bytes.LastIndex(src, body)
+	if len(body) == 0 || start < 0 || offset < start {
+		return " (outside the body of the file)"
+	}
+	s := f.SectionAt(offset - start)
+	if s == nil {
+		return ""
+	}
+	if s.Type == nil {
+		return fmt.Sprintf(" (from generator %q)", s.Generator)
+	}
+	return fmt.Sprintf(" (from generator %q for type %v)", s.Generator, s.Type)
+}
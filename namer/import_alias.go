@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namer
+
+import (
+	"fmt"
+	"go/token"
+	"path"
+	"strings"
+	"unicode"
+
+	"k8s.io/gengo/types"
+)
+
+// ImportAliasPolicy decides the names packages are imported with, so that
+// generated code can follow the conventions of hand-written code. Set it on a
+// DefaultImportTracker.
+//
+// A package is named, in order of preference:
+//  1. by its entry in Aliases;
+//  2. by the first of Rules matching its path;
+//  3. by its last path segment, then its last two segments joined, and so on;
+//  4. by its last segment followed by 2, 3, and so on (after an underscore if
+//     the segment ends in a digit, e.g. v1_2).
+//
+// The first name which is a valid identifier, isn't a keyword, isn't reserved
+// and isn't already taken by another package is used. The name only depends on
+// the path and on the names already taken, so a given sequence of packages is
+// always named the same way.
+type ImportAliasPolicy struct {
+	// The names of packages, by import path. These names are never given
+	// to other packages.
+	Aliases map[string]string
+
+	// Rules for the paths without an explicit alias; the first matching one
+	// applies.
+	Rules []ImportAliasRule
+
+	// Names which are never used, e.g. because the generated code uses them
+	// for something else.
+	Reserved []string
+}
+
+// ImportAliasRule names the packages whose path matches a pattern.
+type ImportAliasRule struct {
+	// A pattern for path.Match, e.g. "k8s.io/api/*/*".
+	Pattern string
+
+	// The number of trailing path segments joined to form the name, e.g. 2
+	// to name "k8s.io/api/core/v1" "corev1".
+	Segments int
+}
+
+// ParseImportAliasRule parses a rule of the form "pattern=segments", e.g.
+// "k8s.io/api/*/*=2".
+func ParseImportAliasRule(s string) (ImportAliasRule, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return ImportAliasRule{}, fmt.Errorf("import alias rule %q is not of the form pattern=segments", s)
+	}
+	rule := ImportAliasRule{Pattern: s[:i]}
+	if _, err := fmt.Sscanf(s[i+1:], "%d", &rule.Segments); err != nil || rule.Segments < 1 {
+		return ImportAliasRule{}, fmt.Errorf("import alias rule %q must have a positive number of segments", s)
+	}
+	if _, err := path.Match(rule.Pattern, ""); err != nil {
+		return ImportAliasRule{}, fmt.Errorf("import alias rule %q has an invalid pattern: %v", s, err)
+	}
+	return rule, nil
+}
+
+// LocalName returns the name to import the named package with, given the
+// names the tracker has already given out.
+func (p *ImportAliasPolicy) LocalName(tracker ImportTracker, name types.Name) string {
+	pkgPath := name.Path
+	if len(pkgPath) == 0 {
+		pkgPath = name.Package
+	}
+	if alias, found := p.Aliases[pkgPath]; found {
+		return alias
+	}
+
+	segments := strings.Split(pkgPath, GoSeperator)
+	candidates := []string{}
+	for _, r := range p.Rules {
+		if matched, _ := path.Match(r.Pattern, pkgPath); matched {
+			candidates = append(candidates, aliasOf(segments, r.Segments))
+			break
+		}
+	}
+	for n := 1; n <= len(segments); n++ {
+		candidates = append(candidates, aliasOf(segments, n))
+	}
+	for _, c := range candidates {
+		if p.available(tracker, pkgPath, c) {
+			return c
+		}
+	}
+	base := aliasOf(segments, 1)
+	if base == "" || !unicode.IsLetter([]rune(base)[0]) {
+		base = "pkg" + base
+	}
+	// Keep the number apart from one ending the base, e.g. v1_2 rather
+	// than v12.
+	format := "%s%d"
+	if r := []rune(base); unicode.IsDigit(r[len(r)-1]) {
+		format = "%s_%d"
+	}
+	for i := 2; ; i++ {
+		if c := fmt.Sprintf(format, base, i); p.available(tracker, pkgPath, c) {
+			return c
+		}
+	}
+}
+
+// available returns whether pkgPath may be named 'alias'.
+func (p *ImportAliasPolicy) available(tracker ImportTracker, pkgPath, alias string) bool {
+	if alias == "" || !unicode.IsLetter([]rune(alias)[0]) || token.Lookup(alias).IsKeyword() {
+		return false
+	}
+	for _, r := range p.Reserved {
+		if r == alias {
+			return false
+		}
+	}
+	for other, a := range p.Aliases {
+		if a == alias && other != pkgPath {
+			return false
+		}
+	}
+	if other, taken := tracker.PathOf(alias); taken && other != pkgPath {
+		return false
+	}
+	return true
+}
+
+// aliasOf joins the last n segments of a path into a name, dropping the
+// characters which aren't valid in identifiers.
+func aliasOf(segments []string, n int) string {
+	if n > len(segments) {
+		n = len(segments)
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, strings.Join(segments[len(segments)-n:], ""))
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namer
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/gengo/types"
+)
+
+func TestImportAliasPolicy(t *testing.T) {
+	rule, err := ParseImportAliasRule("k8s.io/api/*/*=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &ImportAliasPolicy{
+		Aliases:  map[string]string{"k8s.io/apimachinery/pkg/apis/meta/v1": "metav1"},
+		Rules:    []ImportAliasRule{rule},
+		Reserved: []string{"runtime"},
+	}
+	tracker := NewDefaultImportTracker(types.Name{})
+	tracker.IsInvalidType = func(*types.Type) bool { return false }
+	tracker.AliasPolicy = policy
+
+	paths := []string{
+		"k8s.io/api/core/v1",
+		"k8s.io/api/apps/v1",
+		"example.com/v1",
+		"example.com/other/v1",
+		"k8s.io/apimachinery/pkg/apis/meta/v1",
+		"k8s.io/apimachinery/pkg/runtime",
+		"example.com/metav1",
+		"example.com/type",
+		"x/y/v1",
+		"y/v1",
+	}
+	for _, p := range paths {
+		tracker.AddType(&types.Type{Name: types.Name{Package: p, Name: "T"}})
+	}
+	expected := map[string]string{
+		"k8s.io/api/core/v1":                   "corev1",
+		"k8s.io/api/apps/v1":                   "appsv1",
+		"example.com/v1":                       "v1",
+		"example.com/other/v1":                 "otherv1",
+		"k8s.io/apimachinery/pkg/apis/meta/v1": "metav1",
+		"k8s.io/apimachinery/pkg/runtime":      "pkgruntime",
+		"example.com/metav1":                   "examplecommetav1",
+		"example.com/type":                     "examplecomtype",
+		"x/y/v1":                               "yv1",
+		"y/v1":                                 "v1_2",
+	}
+	actual := map[string]string{}
+	for _, p := range paths {
+		actual[p] = tracker.LocalNameOf(p)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("wanted %v, got %v", expected, actual)
+	}
+
+	if _, err := ParseImportAliasRule("k8s.io/api/*"); err == nil {
+		t.Errorf("expected an error for a rule without segments")
+	}
+}
@@ -38,6 +38,8 @@ type DefaultImportTracker struct {
 	IsInvalidType func(*types.Type) bool
 	// Returns the final local name for the given name
 	LocalName func(types.Name) string
+	// If set, names packages instead of LocalName.
+	AliasPolicy *ImportAliasPolicy
 	// Returns the "import" line for a given (path, name).
 	PrintImport func(string, string) string
 }
@@ -80,7 +82,12 @@ func (tracker *DefaultImportTracker) AddType(t *types.Type) {
 	if _, ok := tracker.pathToName[path]; ok {
 		return
 	}
-	name := tracker.LocalName(t.Name)
+	var name string
+	if tracker.AliasPolicy != nil {
+		name = tracker.AliasPolicy.LocalName(tracker, t.Name)
+	} else {
+		name = tracker.LocalName(t.Name)
+	}
 	tracker.nameToPath[name] = path
 	tracker.pathToName[path] = name
 }
@@ -0,0 +1,44 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namer
+
+import (
+	"sync"
+
+	"k8s.io/gengo/types"
+)
+
+// NewSynchronizedNamer returns a Namer which serializes calls to n, so that it
+// can be shared between goroutines. Most namers cache the names they compute,
+// and are not safe for concurrent use by themselves.
+func NewSynchronizedNamer(n Namer) Namer {
+	if _, ok := n.(*synchronizedNamer); ok {
+		return n
+	}
+	return &synchronizedNamer{namer: n}
+}
+
+type synchronizedNamer struct {
+	lock  sync.Mutex
+	namer Namer
+}
+
+func (s *synchronizedNamer) Name(t *types.Type) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.namer.Name(t)
+}
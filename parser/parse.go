@@ -17,6 +17,9 @@ limitations under the License.
 package parser
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"go/ast"
 	"go/build"
@@ -31,6 +34,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"k8s.io/gengo/types"
 	"k8s.io/klog"
@@ -44,7 +48,8 @@ type importPathString string
 type Builder struct {
 	context *build.Context
 
-	// If true, include *_test.go
+	// If true, include *_test.go files in the package under test. Files of
+	// external test packages (package <name>_test) are never included.
 	IncludeTestFiles bool
 
 	// Map of package names to more canonical information about the package.
@@ -77,6 +82,19 @@ type Builder struct {
 
 	// map of file name to line of comments
 	commentLines map[string][]int
+
+	// If non-nil, the memory layout of types is recorded in the universe
+	// using these sizes.
+	sizes tc.Sizes
+
+	// Set for the duration of the *Context methods; parsing stops once it is
+	// done.
+	ctx context.Context
+
+	// Serializes the methods which may be called while generating
+	// concurrently: CheckFiles, which may parse more packages, and
+	// PackageHash.
+	lock sync.Mutex
 }
 
 type declScope struct {
@@ -87,6 +105,8 @@ type declScope struct {
 type parsedFile struct {
 	name string
 	file *ast.File
+	// The SHA-256 of the file's source.
+	hash [sha256.Size]byte
 }
 
 // key type for finding comments.
@@ -129,6 +149,26 @@ func (b *Builder) AddBuildTags(tags ...string) {
 	b.context.BuildTags = append(b.context.BuildTags, tags...)
 }
 
+// ComputeLayouts asks the builder to record the size, alignment and (for
+// structs) field offsets of every type which has a well-defined size, as laid
+// out by the gc compiler for the given GOARCH. An empty goarch means the
+// architecture of the build context. This must be called before any packages
+// are added.
+func (b *Builder) ComputeLayouts(goarch string) error {
+	if len(b.parsed) > 0 || len(b.buildPackages) > 0 || len(b.typeCheckedPackages) > 0 {
+		return fmt.Errorf("layouts must be computed before any packages are added")
+	}
+	if goarch == "" {
+		goarch = b.context.GOARCH
+	}
+	sizes := tc.SizesFor("gc", goarch)
+	if sizes == nil {
+		return fmt.Errorf("unknown architecture %q", goarch)
+	}
+	b.sizes = sizes
+	return nil
+}
+
 // Get package information from the go/build package. Automatically excludes
 // e.g. test files and files for other platforms-- there is quite a bit of
 // logic of that nature in the build package.
@@ -205,7 +245,7 @@ func (b *Builder) addFile(pkgPath importPathString, path string, src []byte, use
 	// call into here without calling addDir.
 	b.userRequested[pkgPath] = userRequested || b.userRequested[pkgPath]
 
-	b.parsed[pkgPath] = append(b.parsed[pkgPath], parsedFile{path, p})
+	b.parsed[pkgPath] = append(b.parsed[pkgPath], parsedFile{path, p, sha256.Sum256(src)})
 	for _, d := range p.Decls {
 		position := b.fset.Position(d.Pos())
 		endPosition := b.fset.Position(d.End())
@@ -242,6 +282,46 @@ func (b *Builder) AddDir(dir string) error {
 	return err
 }
 
+// AddDirContext is like AddDir, but stops once ctx is done. In that case the
+// returned error wraps ctx.Err(), so it can be recognized with errors.Is.
+func (b *Builder) AddDirContext(ctx context.Context, dir string) error {
+	return b.withContext(ctx, func() error {
+		return b.AddDir(dir)
+	})
+}
+
+// AddDirRecursiveContext is like AddDirRecursive, but stops once ctx is done.
+// In that case the returned error wraps ctx.Err().
+func (b *Builder) AddDirRecursiveContext(ctx context.Context, dir string) error {
+	return b.withContext(ctx, func() error {
+		return b.AddDirRecursive(dir)
+	})
+}
+
+// withContext runs f, which stops early if ctx is done.
+func (b *Builder) withContext(ctx context.Context, f func() error) error {
+	b.ctx = ctx
+	defer func() { b.ctx = nil }()
+	if err := b.canceled(); err != nil {
+		return err
+	}
+	err := f()
+	// Errors caused by the cancellation may have been wrapped, or ignored
+	// along the way, so check again.
+	if err := b.canceled(); err != nil {
+		return err
+	}
+	return err
+}
+
+// canceled returns an error if the context of the current call is done.
+func (b *Builder) canceled() error {
+	if b.ctx == nil || b.ctx.Err() == nil {
+		return nil
+	}
+	return fmt.Errorf("parsing stopped: %w", b.ctx.Err())
+}
+
 // AddDirRecursive is just like AddDir, but it also recursively adds
 // subdirectories; it returns an error only if the path couldn't be resolved;
 // any directories recursed into without go source are ignored.
@@ -259,6 +339,9 @@ func (b *Builder) AddDirRecursive(dir string) error {
 	}
 
 	fn := func(filePath string, info os.FileInfo, err error) error {
+		if err := b.canceled(); err != nil {
+			return err
+		}
 		if info != nil && info.IsDir() {
 			rel := filepath.ToSlash(strings.TrimPrefix(filePath, realPath))
 			if rel != "" {
@@ -342,6 +425,9 @@ func (b *Builder) addDir(dir string, userRequested bool) error {
 	}
 
 	for _, file := range files {
+		if err := b.canceled(); err != nil {
+			return err
+		}
 		if !strings.HasSuffix(file, ".go") {
 			continue
 		}
@@ -455,12 +541,176 @@ func (b *Builder) typeCheckPackage(pkgPath importPathString) (*tc.Package, error
 		Error: func(err error) {
 			klog.V(2).Infof("type checker: %v\n", err)
 		},
+		Sizes: b.sizes,
 	}
 	pkg, err := c.Check(string(pkgPath), b.fset, files, nil)
 	b.typeCheckedPackages[pkgPath] = pkg // record the result whether or not there was an error
 	return pkg, err
 }
 
+// CheckFiles type-checks the package at pkgPath (an import path) as it would be
+// with the given files (by name) added to it, replacing any of its files with
+// the same names. The package's other files are those parsed for it, or else
+// the Go files in 'dir' which match the builder's build tags. Unlike parsing,
+// this checks function bodies. It returns the type errors found; the error is
+// only set if the files can't be parsed.
+//
+// If any of the given files are tests, the package is checked with its test
+// files, whether or not they were parsed. Files in the external test package
+// (i.e. in package <name>_test) are checked separately, with the external test
+// files in 'dir', against the package with the other files.
+func (b *Builder) CheckFiles(pkgPath, dir string, files map[string][]byte) ([]tc.Error, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	asts, xtests := []*ast.File{}, []*ast.File{}
+	tests := false
+	for _, name := range names {
+		f, err := parser.ParseFile(b.fset, filepath.Join(dir, name), files[name], parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(name, "_test.go") {
+			asts = append(asts, f)
+			continue
+		}
+		tests = true
+		if strings.HasSuffix(f.Name.Name, "_test") {
+			xtests = append(xtests, f)
+		} else {
+			asts = append(asts, f)
+		}
+	}
+
+	// Which of the package's own files are needed.
+	var needed []string
+	if parsed, found := b.parsed[importPathString(pkgPath)]; found {
+		for _, f := range parsed {
+			if _, replaced := files[filepath.Base(f.name)]; !replaced {
+				asts = append(asts, f.file)
+			}
+		}
+		if tests && !b.IncludeTestFiles {
+			if buildPkg, err := b.context.ImportDir(dir, 0); err == nil {
+				needed = buildPkg.TestGoFiles
+			}
+		}
+	} else if buildPkg, err := b.context.ImportDir(dir, 0); err == nil {
+		needed = buildPkg.GoFiles
+		if tests {
+			needed = append(needed, buildPkg.TestGoFiles...)
+		}
+	}
+	own, err := b.readFiles(dir, needed, files)
+	if err != nil {
+		return nil, err
+	}
+	asts = append(asts, own...)
+
+	errs := []tc.Error{}
+	c := tc.Config{
+		Importer: importAdapter{b},
+		Error: func(err error) {
+			if e, ok := err.(tc.Error); ok {
+				errs = append(errs, e)
+			}
+		},
+		Sizes: b.sizes,
+	}
+	pkg, _ := c.Check(pkgPath, b.fset, asts, nil)
+	if len(xtests) == 0 {
+		return errs, nil
+	}
+
+	if buildPkg, err := b.context.ImportDir(dir, 0); err == nil {
+		own, err := b.readFiles(dir, buildPkg.XTestGoFiles, files)
+		if err != nil {
+			return nil, err
+		}
+		xtests = append(xtests, own...)
+	}
+	c.Importer = xtestImporter{importAdapter{b}, pkg}
+	c.Check(pkgPath+"_test", b.fset, xtests, nil)
+	return errs, nil
+}
+
+// readFiles parses the named files in dir, except those in 'replaced'.
+func (b *Builder) readFiles(dir string, names []string, replaced map[string][]byte) ([]*ast.File, error) {
+	out := []*ast.File{}
+	for _, name := range names {
+		if _, found := replaced[name]; found {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(b.fset, path, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// xtestImporter imports the package under test, as checked with its test
+// files, for its external tests.
+type xtestImporter struct {
+	importAdapter
+	pkg *tc.Package
+}
+
+func (x xtestImporter) Import(path string) (*tc.Package, error) {
+	if x.pkg != nil && path == x.pkg.Path() {
+		return x.pkg, nil
+	}
+	return x.importAdapter.Import(path)
+}
+
+// PackageHash returns a hash of the source of the named package, i.e. of the
+// names and contents of the files parsed for it. Imports are not included. It
+// returns false if the package has not been parsed.
+func (b *Builder) PackageHash(pkgPath string) (string, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	files, found := b.parsed[importPathString(pkgPath)]
+	if !found {
+		return "", false
+	}
+	sorted := make([]parsedFile, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	h := sha256.New()
+	for _, f := range sorted {
+		fmt.Fprintf(h, "%s\x00%x\n", filepath.Base(f.name), f.hash)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// PackageImports returns the sorted paths of the packages imported by the
+// parsed files of the given package, whether or not it was requested by the
+// user. It returns false if the package has not been parsed.
+func (b *Builder) PackageImports(pkgPath string) ([]string, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, found := b.parsed[importPathString(pkgPath)]; !found {
+		return nil, false
+	}
+	imports := []string{}
+	for imp := range b.importGraph[importPathString(pkgPath)] {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	return imports, true
+}
+
 // FindPackages fetches a list of the user-imported packages.
 // Note that you need to call b.FindTypes() first.
 func (b *Builder) FindPackages() []string {
@@ -483,6 +733,21 @@ func (b *Builder) FindPackages() []string {
 	return result
 }
 
+// FindTypesContext is like FindTypes, but stops once ctx is done. In that
+// case the returned error wraps ctx.Err().
+func (b *Builder) FindTypesContext(ctx context.Context) (types.Universe, error) {
+	var u types.Universe
+	err := b.withContext(ctx, func() error {
+		var err error
+		u, err = b.FindTypes()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
 // FindTypes finalizes the package imports, and searches through all the
 // packages for types.
 func (b *Builder) FindTypes() (types.Universe, error) {
@@ -507,6 +772,9 @@ func (b *Builder) FindTypes() (types.Universe, error) {
 // for types.
 func (b *Builder) findTypesIn(pkgPath importPathString, u *types.Universe) error {
 	klog.V(5).Infof("findTypesIn %s", pkgPath)
+	if err := b.canceled(); err != nil {
+		return err
+	}
 	pkg := b.typeCheckedPackages[pkgPath]
 	if pkg == nil {
 		return fmt.Errorf("findTypesIn(%s): package is not known", pkgPath)
@@ -546,6 +814,7 @@ func (b *Builder) findTypesIn(pkgPath importPathString, u *types.Universe) error
 		tn, ok := obj.(*tc.TypeName)
 		if ok {
 			t := b.walkType(*u, nil, tn.Type())
+			t.Position = b.fset.Position(obj.Pos())
 			c1 := b.priorCommentLines(obj.Pos(), 1)
 			// c1.Text() is safe if c1 is nil
 			t.CommentLines = splitLines(c1.Text())
@@ -559,6 +828,7 @@ func (b *Builder) findTypesIn(pkgPath importPathString, u *types.Universe) error
 		// We only care about functions, not concrete/abstract methods.
 		if ok && tf.Type() != nil && tf.Type().(*tc.Signature).Recv() == nil {
 			t := b.addFunction(*u, nil, tf)
+			t.Position = b.fset.Position(obj.Pos())
 			c1 := b.priorCommentLines(obj.Pos(), 1)
 			// c1.Text() is safe if c1 is nil
 			t.CommentLines = splitLines(c1.Text())
@@ -571,6 +841,7 @@ func (b *Builder) findTypesIn(pkgPath importPathString, u *types.Universe) error
 		tv, ok := obj.(*tc.Var)
 		if ok && !tv.IsField() {
 			t := b.addVariable(*u, nil, tv)
+			t.Position = b.fset.Position(obj.Pos())
 			c1 := b.parseCommentLines(obj.Pos())
 			t.CommentLines = splitLines(c1.Text())
 		}
@@ -585,11 +856,14 @@ func (b *Builder) findTypesIn(pkgPath importPathString, u *types.Universe) error
 			//     ErrCodeRbdTrash
 			// )
 			t := b.addConstant(*u, nil, tconst)
+			t.Position = b.fset.Position(obj.Pos())
 			c1 := b.parseCommentLines(obj.Pos())
 			t.CommentLines = splitLines(c1.Text())
 		}
 	}
 
+	b.addConstGroups(*u, pkgPath)
+
 	importedPkgs := []string{}
 	for k := range b.importGraph[pkgPath] {
 		importedPkgs = append(importedPkgs, string(k))
@@ -601,6 +875,66 @@ func (b *Builder) findTypesIn(pkgPath importPathString, u *types.Universe) error
 	return nil
 }
 
+// addConstGroups records the `const` declaration each of the package's
+// constants came from. The constants must already have been added to u.
+func (b *Builder) addConstGroups(u types.Universe, pkgPath importPathString) {
+	pkg := u.Package(string(pkgPath))
+	// findTypesIn might be called multiple times.
+	pkg.ConstGroups = nil
+	for _, f := range b.parsed[pkgPath] {
+		for _, d := range f.file.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST {
+				continue
+			}
+			group := &types.ConstGroup{Package: pkg.Path}
+			if gd.Doc != nil {
+				group.CommentLines = splitLines(gd.Doc.Text())
+			}
+			// A spec without values repeats the previous spec's values.
+			var values []ast.Expr
+			for i, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Values) > 0 {
+					values = vs.Values
+				}
+				usesIota := false
+				for _, v := range values {
+					if refersToIota(v) {
+						usesIota = true
+					}
+				}
+				for _, n := range vs.Names {
+					if n.Name == "_" {
+						continue
+					}
+					c, ok := pkg.Constants[n.Name]
+					if !ok {
+						continue
+					}
+					c.ConstGroup = group
+					c.ConstIndex = i
+					c.ConstUsesIota = usesIota
+					group.Constants = append(group.Constants, c)
+				}
+			}
+			pkg.ConstGroups = append(pkg.ConstGroups, group)
+		}
+	}
+}
+
+// refersToIota returns true if the expression mentions iota.
+func refersToIota(e ast.Expr) bool {
+	found := false
+	ast.Inspect(e, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "iota" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
 func (b *Builder) importWithMode(dir string, mode build.ImportMode) (*build.Package, error) {
 	// This is a bit of a hack.  The srcDir argument to Import() should
 	// properly be the dir of the file which depends on the package to be
@@ -744,6 +1078,7 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 			}
 			out.Members = append(out.Members, m)
 		}
+		b.recordLayout(u, out, t)
 		return out
 	case *tc.Map:
 		out := u.Type(name)
@@ -753,6 +1088,7 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 		out.Kind = types.Map
 		out.Elem = b.walkType(u, nil, t.Elem())
 		out.Key = b.walkType(u, nil, t.Key())
+		b.recordLayout(u, out, t)
 		return out
 	case *tc.Pointer:
 		out := u.Type(name)
@@ -761,6 +1097,7 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 		}
 		out.Kind = types.Pointer
 		out.Elem = b.walkType(u, nil, t.Elem())
+		b.recordLayout(u, out, t)
 		return out
 	case *tc.Slice:
 		out := u.Type(name)
@@ -769,6 +1106,7 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 		}
 		out.Kind = types.Slice
 		out.Elem = b.walkType(u, nil, t.Elem())
+		b.recordLayout(u, out, t)
 		return out
 	case *tc.Array:
 		out := u.Type(name)
@@ -779,6 +1117,7 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 		out.Elem = b.walkType(u, nil, t.Elem())
 		// TODO: need to store array length, otherwise raw type name
 		// cannot be properly written.
+		b.recordLayout(u, out, t)
 		return out
 	case *tc.Chan:
 		out := u.Type(name)
@@ -789,12 +1128,14 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 		out.Elem = b.walkType(u, nil, t.Elem())
 		// TODO: need to store direction, otherwise raw type name
 		// cannot be properly written.
+		b.recordLayout(u, out, t)
 		return out
 	case *tc.Basic:
 		out := u.Type(types.Name{
 			Package: "",
 			Name:    t.Name(),
 		})
+		b.recordLayout(u, out, t)
 		if out.Kind != types.Unknown {
 			return out
 		}
@@ -807,6 +1148,7 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 		}
 		out.Kind = types.Func
 		out.Signature = b.convertSignature(u, t)
+		b.recordLayout(u, out, t)
 		return out
 	case *tc.Interface:
 		out := u.Type(name)
@@ -821,6 +1163,7 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 			}
 			out.Methods[t.Method(i).Name()] = b.walkType(u, nil, t.Method(i).Type())
 		}
+		b.recordLayout(u, out, t)
 		return out
 	case *tc.Named:
 		var out *types.Type
@@ -833,6 +1176,7 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 			}
 			out.Kind = types.Alias
 			out.Underlying = b.walkType(u, nil, t.Underlying())
+			b.recordLayout(u, out, t)
 		default:
 			// tc package makes everything "named" with an
 			// underlying anonymous type--we remove that annoying
@@ -869,6 +1213,52 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 	}
 }
 
+// recordLayout stores the memory layout of 'in' for 'out', if layouts were
+// requested and 'in' can be laid out.
+func (b *Builder) recordLayout(u types.Universe, out *types.Type, in tc.Type) {
+	if b.sizes == nil || !hasLayout(in) {
+		return
+	}
+	layouts := u.Package(out.Name.Package).Layouts
+	if _, found := layouts[out.Name.Name]; found {
+		return
+	}
+	l := &types.Layout{
+		Size:  b.sizes.Sizeof(in),
+		Align: b.sizes.Alignof(in),
+	}
+	if st, ok := in.Underlying().(*tc.Struct); ok && st.NumFields() > 0 {
+		fields := make([]*tc.Var, st.NumFields())
+		for i := range fields {
+			fields[i] = st.Field(i)
+		}
+		l.Offsets = b.sizes.Offsetsof(fields)
+	}
+	layouts[out.Name.Name] = l
+}
+
+// hasLayout returns true if the size of t is well defined, i.e. it is not
+// (and does not contain) an untyped or invalid type.
+func hasLayout(t tc.Type) bool {
+	switch t := t.Underlying().(type) {
+	case *tc.Basic:
+		return t.Kind() != tc.Invalid && t.Info()&tc.IsUntyped == 0
+	case *tc.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if !hasLayout(t.Field(i).Type()) {
+				return false
+			}
+		}
+		return true
+	case *tc.Array:
+		return hasLayout(t.Elem())
+	case *tc.Pointer, *tc.Slice, *tc.Map, *tc.Chan, *tc.Signature, *tc.Interface:
+		return true
+	default:
+		return false
+	}
+}
+
 func (b *Builder) addFunction(u types.Universe, useName *types.Name, in *tc.Func) *types.Type {
 	name := tcFuncNameToName(in.String())
 	if useName != nil {
@@ -900,6 +1290,7 @@ func (b *Builder) addConstant(u types.Universe, useName *types.Name, in *tc.Cons
 	out.Kind = types.DeclarationOf
 	out.Underlying = b.walkType(u, nil, in.Type())
 	out.ConstValue = constant.Val(in.Val())
+	out.ConstExact = in.Val()
 	return out
 }
 
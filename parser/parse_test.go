@@ -18,6 +18,8 @@ package parser_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"path"
 	"path/filepath"
 	"reflect"
@@ -62,6 +64,21 @@ func TestRecursive(t *testing.T) {
 	}
 }
 
+func TestRecursiveContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b := parser.New()
+	if err := b.AddDirRecursiveContext(ctx, "k8s.io/gengo/testdata/a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancellation error, got %v", err)
+	}
+	if pkgs := b.FindPackages(); len(pkgs) != 0 {
+		t.Errorf("expected no packages, got %v", pkgs)
+	}
+	if _, err := b.FindTypesContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancellation error, got %v", err)
+	}
+}
+
 func TestRecursiveWithTestGoFiles(t *testing.T) {
 	d := args.Default()
 	d.IncludeTestFiles = true
@@ -298,6 +315,195 @@ func TestStructParse(t *testing.T) {
 	}
 }
 
+func TestStructLayout(t *testing.T) {
+	var layoutTest = file{
+		path: "base/foo/proto/foo.go",
+		contents: `
+            package foo
+
+            type Blah struct {
+	            A bool
+	            B int64
+	            C int32
+	            D [3]uint16
+            }
+            `,
+	}
+
+	testCases := []struct {
+		arch    string
+		size    int64
+		align   int64
+		offsets []int64
+		padding int64
+	}{
+		{arch: "amd64", size: 32, align: 8, offsets: []int64{0, 8, 16, 20}, padding: 13},
+		{arch: "386", size: 24, align: 4, offsets: []int64{0, 4, 12, 16}, padding: 5},
+	}
+	for _, tc := range testCases {
+		b := parser.New()
+		if err := b.ComputeLayouts(tc.arch); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.AddFileForTest(path.Dir(layoutTest.path), filepath.FromSlash(layoutTest.path), []byte(layoutTest.contents)); err != nil {
+			t.Fatal(err)
+		}
+		u, err := b.FindTypes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blahT := u.Type(types.Name{Package: "base/foo/proto", Name: "Blah"})
+		l := u.Layout(blahT)
+		if l == nil {
+			t.Fatalf("%s: no layout recorded for %v", tc.arch, blahT)
+		}
+		if e, a := (types.Layout{Size: tc.size, Align: tc.align, Offsets: tc.offsets}), *l; !reflect.DeepEqual(e, a) {
+			t.Errorf("%s: wanted layout %#v, got %#v", tc.arch, e, a)
+		}
+		if l := u.Layout(types.Int64); l == nil || l.Size != 8 {
+			t.Errorf("%s: wrong layout for int64: %#v", tc.arch, l)
+		}
+		if padding, ok := u.StructPadding(blahT); !ok || padding != tc.padding {
+			t.Errorf("%s: wanted padding %v, got %v (%v)", tc.arch, tc.padding, padding, ok)
+		}
+	}
+
+	if err := parser.New().ComputeLayouts("nonesuch"); err == nil {
+		t.Errorf("expected an error for an unknown architecture")
+	}
+	b := parser.New()
+	if err := b.AddFileForTest("base/foo/proto", "/tmp/base/foo/proto/foo.go", []byte(layoutTest.contents)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ComputeLayouts("amd64"); err == nil {
+		t.Errorf("expected an error computing layouts after adding packages")
+	}
+	_, u, _ := construct(t, []file{layoutTest}, namer.NewPublicNamer(0))
+	if l := u.Layout(u.Type(types.Name{Package: "base/foo/proto", Name: "Blah"})); l != nil {
+		t.Errorf("expected no layout unless requested, got %#v", l)
+	}
+}
+
+func TestReferenceLayout(t *testing.T) {
+	var layoutTest = file{
+		path: "base/foo/proto/foo.go",
+		contents: `
+            package foo
+
+            type Refs struct {
+	            A bool
+	            P *int64
+	            S []string
+	            M map[string]int
+	            I interface{}
+            }
+            `,
+	}
+
+	testCases := []struct {
+		arch    string
+		size    int64
+		offsets []int64
+		slice   int64
+		padding int64
+	}{
+		{arch: "amd64", size: 64, offsets: []int64{0, 8, 16, 40, 48}, slice: 24, padding: 7},
+		{arch: "386", size: 32, offsets: []int64{0, 4, 8, 20, 24}, slice: 12, padding: 3},
+	}
+	for _, tc := range testCases {
+		b := parser.New()
+		if err := b.ComputeLayouts(tc.arch); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.AddFileForTest(path.Dir(layoutTest.path), filepath.FromSlash(layoutTest.path), []byte(layoutTest.contents)); err != nil {
+			t.Fatal(err)
+		}
+		u, err := b.FindTypes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		refsT := u.Type(types.Name{Package: "base/foo/proto", Name: "Refs"})
+		if l := u.Layout(refsT); l == nil || l.Size != tc.size || !reflect.DeepEqual(l.Offsets, tc.offsets) {
+			t.Errorf("%s: wanted size %d and offsets %v, got %#v", tc.arch, tc.size, tc.offsets, l)
+		}
+		if l := u.Layout(refsT.Members[2].Type); l == nil || l.Size != tc.slice {
+			t.Errorf("%s: wrong layout for %v: %#v", tc.arch, refsT.Members[2].Type, l)
+		}
+		if padding, ok := u.StructPadding(refsT); !ok || padding != tc.padding {
+			t.Errorf("%s: wanted padding %v, got %v (%v)", tc.arch, tc.padding, padding, ok)
+		}
+	}
+}
+
+func TestConstGroups(t *testing.T) {
+	var constTest = file{
+		path: "base/foo/proto/foo.go",
+		contents: `
+            package foo
+
+            type Code int
+
+            const Single = "single"
+
+            // Codes are codes.
+            const (
+	            CodeA Code = iota + 1
+	            CodeB
+	            _
+	            CodeD
+	            Big = 1 << 100
+	            Third = 1.0 / 3
+            )
+            `,
+	}
+
+	_, u, _ := construct(t, []file{constTest}, namer.NewPublicNamer(0))
+	pkg := u.Package("base/foo/proto")
+	if e, a := 2, len(pkg.ConstGroups); e != a {
+		t.Fatalf("wanted %v const groups, got %v", e, a)
+	}
+	if e, a := []*types.Type{pkg.Constants["Single"]}, pkg.ConstGroups[0].Constants; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted %v, got %v", e, a)
+	}
+	group := pkg.ConstGroups[1]
+	if e, a := []string{"Codes are codes."}, group.CommentLines; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted comments %q, got %q", e, a)
+	}
+	code := u.Type(types.Name{Package: "base/foo/proto", Name: "Code"})
+	expected := []struct {
+		name     string
+		index    int
+		usesIota bool
+		exact    string
+		typ      *types.Type
+	}{
+		{"CodeA", 0, true, "1", code},
+		{"CodeB", 1, true, "2", code},
+		{"CodeD", 3, true, "4", code},
+		{"Big", 4, false, "1267650600228229401496703205376", nil},
+		{"Third", 5, false, "1/3", nil},
+	}
+	if e, a := len(expected), len(group.Constants); e != a {
+		t.Fatalf("wanted %v constants, got %v", e, a)
+	}
+	for i, e := range expected {
+		c := group.Constants[i]
+		if c != pkg.Constants[e.name] {
+			t.Errorf("%d: wanted constant %v, got %v", i, e.name, c)
+			continue
+		}
+		if c.ConstGroup != group || c.ConstIndex != e.index || c.ConstUsesIota != e.usesIota {
+			t.Errorf("%s: wanted index %v and iota %v, got %v and %v", e.name, e.index, e.usesIota, c.ConstIndex, c.ConstUsesIota)
+		}
+		if c.ConstExact == nil || c.ConstExact.ExactString() != e.exact {
+			t.Errorf("%s: wanted exact value %v, got %v", e.name, e.exact, c.ConstExact)
+		}
+		if e.typ != nil && c.Underlying != e.typ {
+			t.Errorf("%s: wanted type %v, got %v", e.name, e.typ, c.Underlying)
+		}
+	}
+}
+
 func TestParseSecondClosestCommentLines(t *testing.T) {
 	const fileName = "base/foo/proto/foo.go"
 	testCases := []struct {
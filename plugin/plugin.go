@@ -0,0 +1,238 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin runs generators as separate programs.
+//
+// A host parses the inputs once, and runs any number of plugins against the
+// result. Each plugin is an executable which reads a single Request, encoded
+// as JSON, from its standard input, and writes a single Response to its
+// standard output. The request carries the serialized universe (see
+// types.MarshalUniverse) and the plugin's command-line arguments; the
+// response carries the generated files, which the host assembles, formats and
+// verifies with the file types of its own generator.Context, exactly as if the
+// generators had run in-process.
+//
+// A generator becomes a plugin by calling Main instead of args.Execute:
+//
+//	func main() {
+//		plugin.Main(args.Default(), generators.NameSystems(), generators.DefaultNameSystem(), generators.Packages)
+//	}
+//
+// Anything a plugin writes to standard error is passed through to the host's.
+package plugin // import "k8s.io/gengo/plugin"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/types"
+
+	"k8s.io/klog"
+)
+
+// ProtocolVersion identifies the format of Request and Response.
+const ProtocolVersion = "gengo/plugin/v1"
+
+// Request is sent by the host to a plugin.
+type Request struct {
+	Version string `json:"version"`
+
+	// The universe, as encoded by types.MarshalUniverse.
+	Universe json.RawMessage `json:"universe"`
+
+	// The user-specified packages, after recursive expansion (see
+	// generator.Context.Inputs).
+	Inputs []string `json:"inputs"`
+
+	// The directories the host parsed, as passed to --input-dirs.
+	InputDirs []string `json:"inputDirs,omitempty"`
+
+	// Command-line arguments for the plugin, e.g. "--output-package=foo".
+	Args []string `json:"args,omitempty"`
+}
+
+// Response is sent by a plugin back to the host.
+type Response struct {
+	Version string `json:"version"`
+
+	// If set, generation failed and Files should be ignored.
+	Error string `json:"error,omitempty"`
+
+	// The generated files, in order.
+	Files []File `json:"files,omitempty"`
+}
+
+// File is a generated file, before it is assembled by its file type. The
+// fields correspond to those of generator.File.
+type File struct {
+	PackagePath       string   `json:"packagePath"`
+	PackageName       string   `json:"packageName"`
+	PackageSourcePath string   `json:"packageSourcePath,omitempty"`
+	Name              string   `json:"name"`
+	FileType          string   `json:"fileType"`
+	Header            string   `json:"header,omitempty"`
+	Imports           []string `json:"imports,omitempty"`
+	Vars              string   `json:"vars,omitempty"`
+	Consts            string   `json:"consts,omitempty"`
+	Generators        []string `json:"generators,omitempty"`
+	BuildConstraints  []string `json:"buildConstraints,omitempty"`
+	Comments          []string `json:"comments,omitempty"`
+	Directives        []string `json:"directives,omitempty"`
+	ShardOf           string   `json:"shardOf,omitempty"`
+
+	// The body of the file, i.e. everything generated per type.
+	Contents string `json:"contents"`
+}
+
+// NewRequest makes a request for the universe and inputs of the given context.
+func NewRequest(c *generator.Context, inputDirs []string, args []string) (*Request, error) {
+	u, err := types.MarshalUniverse(c.Universe)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{
+		Version:   ProtocolVersion,
+		Universe:  u,
+		Inputs:    c.Inputs,
+		InputDirs: inputDirs,
+		Args:      args,
+	}, nil
+}
+
+// NewFile converts a generated file to its wire form.
+func NewFile(f *generator.File) File {
+	out := File{
+		PackagePath:       f.PackagePath,
+		PackageName:       f.PackageName,
+		PackageSourcePath: f.PackageSourcePath,
+		Name:              f.Name,
+		FileType:          f.FileType,
+		Header:            string(f.Header),
+		Vars:              f.Vars.String(),
+		Consts:            f.Consts.String(),
+		Contents:          f.Body.String(),
+		Generators:        f.Generators,
+		BuildConstraints:  f.BuildConstraints,
+		Comments:          f.Comments,
+		Directives:        f.Directives,
+		ShardOf:           f.ShardOf,
+	}
+	for i := range f.Imports {
+		out.Imports = append(out.Imports, i)
+	}
+	sort.Strings(out.Imports)
+	return out
+}
+
+// GeneratorFile converts the file back to a generator.File.
+func (f File) GeneratorFile() *generator.File {
+	out := &generator.File{
+		Name:              f.Name,
+		FileType:          f.FileType,
+		PackageName:       f.PackageName,
+		PackagePath:       f.PackagePath,
+		PackageSourcePath: f.PackageSourcePath,
+		Header:            []byte(f.Header),
+		Imports:           map[string]struct{}{},
+		Generators:        f.Generators,
+		BuildConstraints:  f.BuildConstraints,
+		Comments:          f.Comments,
+		Directives:        f.Directives,
+		ShardOf:           f.ShardOf,
+	}
+	for _, i := range f.Imports {
+		out.Imports[i] = struct{}{}
+	}
+	out.Vars.WriteString(f.Vars)
+	out.Consts.WriteString(f.Consts)
+	out.Body.WriteString(f.Contents)
+	return out
+}
+
+// Plugin is an executable implementing the plugin protocol.
+type Plugin struct {
+	// The path of the executable.
+	Command string
+
+	// Command-line arguments for the plugin. They are sent in the request,
+	// not passed to the executable.
+	Args []string
+
+	// The input directories, as passed to --input-dirs, to tell the plugin
+	// about.
+	InputDirs []string
+
+	// Where the plugin's standard error goes. Defaults to os.Stderr.
+	Stderr io.Writer
+}
+
+// Generate runs the plugin against the universe of the given context, and
+// returns the files it generated.
+func (p *Plugin) Generate(c *generator.Context) ([]*generator.File, error) {
+	req, err := NewRequest(c, p.InputDirs, p.Args)
+	if err != nil {
+		return nil, err
+	}
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	klog.V(2).Infof("Running plugin %q", p.Command)
+	out := &bytes.Buffer{}
+	cmd := exec.Command(p.Command)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = out
+	cmd.Stderr = p.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("plugin %q failed: %v", p.Command, err)
+	}
+
+	resp := &Response{}
+	if err := json.Unmarshal(out.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("plugin %q sent an invalid response: %v", p.Command, err)
+	}
+	if resp.Version != ProtocolVersion {
+		return nil, fmt.Errorf("plugin %q uses protocol %q, expected %q", p.Command, resp.Version, ProtocolVersion)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin %q failed: %v", p.Command, resp.Error)
+	}
+	files := make([]*generator.File, 0, len(resp.Files))
+	for _, f := range resp.Files {
+		files = append(files, f.GeneratorFile())
+	}
+	return files, nil
+}
+
+// Execute runs the plugin and writes (or, if c.Verify is set, verifies) the
+// files it generated under 'outDir', like generator.Context.ExecutePackages.
+func (p *Plugin) Execute(c *generator.Context, outDir string) error {
+	files, err := p.Generate(c)
+	if err != nil {
+		return err
+	}
+	return c.ExecuteFiles(outDir, files)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/gengo/args"
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/types"
+)
+
+// When this variable is set, the test binary acts as a plugin.
+const runAsPluginEnv = "GENGO_TEST_RUN_AS_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runAsPluginEnv) != "" {
+		Main(args.Default().WithoutDefaultFlagParsing(), namer.NameSystems{"public": namer.NewPublicNamer(0)}, "public", testPackages)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testPackages(c *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	return generator.Packages{&generator.DefaultPackage{
+		PackageName: "out",
+		PackagePath: arguments.OutputPackagePath,
+		HeaderText:  []byte("// Code generated by test. DO NOT EDIT.\n\n"),
+		FilterFunc: func(c *generator.Context, t *types.Type) bool {
+			return t.Kind == types.Struct
+		},
+		GeneratorList: []generator.Generator{&namesGen{DefaultGen: generator.DefaultGen{OptionalName: "names"}}},
+	}}
+}
+
+// namesGen declares a constant with the name of every type.
+type namesGen struct {
+	generator.DefaultGen
+}
+
+func (g *namesGen) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	_, err := fmt.Fprintf(w, "const %sName = %q\n", c.Namers["public"].Name(t), t.Name.Name)
+	return err
+}
+
+func TestPlugin(t *testing.T) {
+	b := types.NewUniverseBuilder()
+	b.Package("example.com/api", "api").Struct("Pod")
+	b.Package("example.com/api", "api").Struct("Node")
+	b.Package("example.com/api", "api").Alias("Phase", types.String)
+	c := generator.NewUniverseContext(b.Universe(), []string{"example.com/api"}, nil, "")
+
+	dir, err := ioutil.TempDir("", "gengo-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv(runAsPluginEnv, "true")
+	defer os.Unsetenv(runAsPluginEnv)
+	p := &Plugin{
+		Command:   os.Args[0],
+		Args:      []string{"--output-package=example.com/out"},
+		InputDirs: []string{"example.com/api"},
+	}
+	if err := p.Execute(c, dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, "example.com/out/names.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Code generated by test. DO NOT EDIT.
+
+package out
+
+const NodeName = "Node"
+const PodName = "Pod"
+`
+	if string(got) != want {
+		t.Errorf("wanted:\n%s\ngot:\n%s", want, got)
+	}
+
+	c.Verify = true
+	if err := p.Execute(c, dir); err != nil {
+		t.Errorf("unexpected verification error: %v", err)
+	}
+
+	p.Args = []string{"--no-such-flag"}
+	if err := p.Execute(c, dir); err == nil || !strings.Contains(err.Error(), "no-such-flag") {
+		t.Errorf("expected an error about the unknown flag, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"encoding/json"
+	goflag "flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s.io/gengo/args"
+	"k8s.io/gengo/generator"
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/types"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+// PackagesFunc returns the packages to generate, like the function passed to
+// args.GeneratorArgs.Execute.
+type PackagesFunc func(*generator.Context, *args.GeneratorArgs) generator.Packages
+
+// Main implements main() for a plugin: it serves a single request from
+// standard input, and exits.
+func Main(g *args.GeneratorArgs, nameSystems namer.NameSystems, defaultSystem string, pkgs PackagesFunc) {
+	if err := Serve(os.Stdin, os.Stdout, g, nameSystems, defaultSystem, pkgs); err != nil {
+		klog.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+}
+
+// Serve reads a request from r, runs the generators and writes the response to
+// w. The arguments in the request are parsed into 'g', along with any flags
+// registered on the global flag sets (e.g. for g.CustomArgs).
+//
+// Errors of the generators are reported in the response; the returned error
+// is only set if no response could be sent.
+func Serve(r io.Reader, w io.Writer, g *args.GeneratorArgs, nameSystems namer.NameSystems, defaultSystem string, pkgs PackagesFunc) error {
+	req := &Request{}
+	if err := json.NewDecoder(r).Decode(req); err != nil {
+		return fmt.Errorf("unable to read the request: %v", err)
+	}
+	resp := &Response{Version: ProtocolVersion}
+	files, err := generate(req, g, nameSystems, defaultSystem, pkgs)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	for _, f := range files {
+		resp.Files = append(resp.Files, NewFile(f))
+	}
+	return json.NewEncoder(w).Encode(resp)
+}
+
+func generate(req *Request, g *args.GeneratorArgs, nameSystems namer.NameSystems, defaultSystem string, pkgs PackagesFunc) ([]*generator.File, error) {
+	if req.Version != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol %q, expected %q", req.Version, ProtocolVersion)
+	}
+	u, err := types.UnmarshalUniverse(req.Universe)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the universe: %v", err)
+	}
+
+	g.InputDirs = req.InputDirs
+	fs := pflag.NewFlagSet("plugin", pflag.ContinueOnError)
+	g.AddFlags(fs)
+	fs.AddFlagSet(pflag.CommandLine)
+	fs.AddGoFlagSet(goflag.CommandLine)
+	if err := fs.Parse(req.Args); err != nil {
+		return nil, err
+	}
+
+	c := generator.NewUniverseContext(u, req.Inputs, nameSystems, defaultSystem)
+	var files []*generator.File
+	var errors []string
+	for _, p := range pkgs(c, g) {
+		generated, err := c.GeneratePackage(p)
+		if err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+		files = append(files, generated...)
+	}
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("some packages had errors:\n%v\n", strings.Join(errors, "\n"))
+	}
+	return files, nil
+}
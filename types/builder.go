@@ -0,0 +1,382 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"go/constant"
+	"strings"
+)
+
+// UniverseBuilder constructs a Universe without parsing any Go source, e.g.
+// for tests or for inputs which don't come from Go at all. The types it
+// produces are shaped like those produced by the parser: anonymous types are
+// named the way go/types prints them, and package imports are recorded for
+// every type referenced from another package.
+//
+// Example:
+//
+//	b := types.NewUniverseBuilder()
+//	obj := b.Package("example.com/meta", "meta").Struct("Object").
+//		Member("Name", types.String, `json:"name"`).
+//		Type()
+//	b.Package("example.com/api", "api").Struct("Pod").
+//		Embed(obj, `json:",inline"`).
+//		Member("Labels", b.Map(types.String, types.String), `json:"labels"`).
+//		PointerMethod("DeepCopy", nil, []*types.Type{b.Pointer(obj)})
+//	u := b.Universe()
+type UniverseBuilder struct {
+	u Universe
+}
+
+// NewUniverseBuilder returns a builder for a new, empty Universe.
+func NewUniverseBuilder() *UniverseBuilder {
+	return &UniverseBuilder{u: Universe{}}
+}
+
+// Universe returns the universe being built.
+func (b *UniverseBuilder) Universe() Universe {
+	return b.u
+}
+
+// Package returns a builder for the package with the given path, creating it
+// if necessary. 'name' is the name in the package's 'package x' line.
+func (b *UniverseBuilder) Package(path, name string) *PackageBuilder {
+	p := b.u.Package(path)
+	p.Name = name
+	return &PackageBuilder{b: b, p: p}
+}
+
+// Pointer returns the canonical pointer type to elem.
+func (b *UniverseBuilder) Pointer(elem *Type) *Type {
+	t := b.u.Type(Name{Name: "*" + elem.Name.String()})
+	if t.Kind == Unknown {
+		t.Kind = Pointer
+		t.Elem = elem
+	}
+	return t
+}
+
+// Slice returns the canonical slice type of elem.
+func (b *UniverseBuilder) Slice(elem *Type) *Type {
+	t := b.u.Type(Name{Name: "[]" + elem.Name.String()})
+	if t.Kind == Unknown {
+		t.Kind = Slice
+		t.Elem = elem
+	}
+	return t
+}
+
+// Map returns the canonical map type from key to elem.
+func (b *UniverseBuilder) Map(key, elem *Type) *Type {
+	t := b.u.Type(Name{Name: "map[" + key.Name.String() + "]" + elem.Name.String()})
+	if t.Kind == Unknown {
+		t.Kind = Map
+		t.Key = key
+		t.Elem = elem
+	}
+	return t
+}
+
+// Func returns the canonical function type with the given parameters and
+// results.
+func (b *UniverseBuilder) Func(params, results []*Type) *Type {
+	return b.signature(params, results, false)
+}
+
+// VariadicFunc returns the canonical function type with the given parameters
+// and results, whose last parameter is variadic. As in types parsed from Go
+// source, that parameter's type is a slice: use Slice(T) for "...T".
+func (b *UniverseBuilder) VariadicFunc(params, results []*Type) *Type {
+	return b.signature(params, results, true)
+}
+
+func (b *UniverseBuilder) signature(params, results []*Type, variadic bool) *Type {
+	t := b.u.Type(Name{Name: funcTypeName(params, results, variadic)})
+	if t.Kind == Unknown {
+		t.Kind = Func
+		t.Signature = &Signature{Parameters: params, Results: results, Variadic: variadic}
+	}
+	return t
+}
+
+func funcTypeName(params, results []*Type, variadic bool) string {
+	names := func(ts []*Type) []string {
+		s := make([]string, len(ts))
+		for i := range ts {
+			s[i] = ts[i].Name.String()
+		}
+		return s
+	}
+	p := names(params)
+	if n := len(params); variadic && n > 0 && params[n-1].Kind == Slice {
+		p[n-1] = "..." + params[n-1].Elem.Name.String()
+	}
+	name := "func(" + strings.Join(p, ", ") + ")"
+	switch len(results) {
+	case 0:
+	case 1:
+		name += " " + names(results)[0]
+	default:
+		name += " (" + strings.Join(names(results), ", ") + ")"
+	}
+	return name
+}
+
+// PackageBuilder adds declarations to a single package.
+type PackageBuilder struct {
+	b *UniverseBuilder
+	p *Package
+}
+
+// Package returns the package being built.
+func (pb *PackageBuilder) Package() *Package {
+	return pb.p
+}
+
+// Universe returns the builder of the universe this package belongs to.
+func (pb *PackageBuilder) Universe() *UniverseBuilder {
+	return pb.b
+}
+
+// Doc sets the package's doc comment lines.
+func (pb *PackageBuilder) Doc(lines ...string) *PackageBuilder {
+	pb.p.DocComments = lines
+	pb.p.Comments = lines
+	return pb
+}
+
+// Import records that the package imports the given packages. Imports of
+// packages whose types are used in declarations are recorded automatically.
+func (pb *PackageBuilder) Import(paths ...string) *PackageBuilder {
+	pb.b.u.AddImports(pb.p.Path, paths...)
+	return pb
+}
+
+// use records imports for any named types t refers to.
+func (pb *PackageBuilder) use(t *Type) {
+	if t == nil {
+		return
+	}
+	if t.Name.Package != "" {
+		if t.Name.Package != pb.p.Path {
+			pb.Import(t.Name.Package)
+		}
+		return
+	}
+	// Anonymous types are defined by what they are made of.
+	pb.use(t.Elem)
+	pb.use(t.Key)
+	if t.Signature != nil {
+		for _, p := range t.Signature.Parameters {
+			pb.use(p)
+		}
+		for _, r := range t.Signature.Results {
+			pb.use(r)
+		}
+	}
+}
+
+// Struct declares a named struct type.
+func (pb *PackageBuilder) Struct(name string) *TypeBuilder {
+	t := pb.p.Type(name)
+	t.Kind = Struct
+	return &TypeBuilder{pb: pb, t: t}
+}
+
+// Interface declares a named interface type. Add its methods with Method.
+func (pb *PackageBuilder) Interface(name string) *TypeBuilder {
+	t := pb.p.Type(name)
+	t.Kind = Interface
+	t.Methods = map[string]*Type{}
+	return &TypeBuilder{pb: pb, t: t}
+}
+
+// Alias declares a named type whose underlying type is 'underlying', e.g.
+// `type Code int`.
+func (pb *PackageBuilder) Alias(name string, underlying *Type) *TypeBuilder {
+	t := pb.p.Type(name)
+	t.Kind = Alias
+	t.Underlying = underlying
+	pb.use(underlying)
+	return &TypeBuilder{pb: pb, t: t}
+}
+
+// Function declares a top-level function.
+func (pb *PackageBuilder) Function(name string, params, results []*Type, commentLines ...string) *PackageBuilder {
+	f := pb.p.Function(name)
+	f.Underlying = pb.b.Func(params, results)
+	f.CommentLines = commentLines
+	pb.use(f.Underlying)
+	return pb
+}
+
+// Variable declares a package-level variable.
+func (pb *PackageBuilder) Variable(name string, t *Type, commentLines ...string) *PackageBuilder {
+	v := pb.p.Variable(name)
+	v.Underlying = t
+	v.CommentLines = commentLines
+	pb.use(t)
+	return pb
+}
+
+// Constant declares a constant in a declaration of its own.
+func (pb *PackageBuilder) Constant(name string, t *Type, value constant.Value, commentLines ...string) *PackageBuilder {
+	return pb.ConstGroup(commentLines...).Constant(name, t, value).Package()
+}
+
+// ConstGroup starts a `const ( ... )` declaration.
+func (pb *PackageBuilder) ConstGroup(commentLines ...string) *ConstGroupBuilder {
+	g := &ConstGroup{Package: pb.p.Path, CommentLines: commentLines}
+	pb.p.ConstGroups = append(pb.p.ConstGroups, g)
+	return &ConstGroupBuilder{pb: pb, g: g}
+}
+
+// TypeBuilder adds details to a single named type.
+type TypeBuilder struct {
+	pb *PackageBuilder
+	t  *Type
+}
+
+// Type returns the type being built.
+func (tb *TypeBuilder) Type() *Type {
+	return tb.t
+}
+
+// Package returns the builder of the package this type belongs to.
+func (tb *TypeBuilder) Package() *PackageBuilder {
+	return tb.pb
+}
+
+// Comments sets the comment lines immediately before the type.
+func (tb *TypeBuilder) Comments(lines ...string) *TypeBuilder {
+	tb.t.CommentLines = lines
+	return tb
+}
+
+// SecondClosestComments sets the comment lines before the type's comments.
+func (tb *TypeBuilder) SecondClosestComments(lines ...string) *TypeBuilder {
+	tb.t.SecondClosestCommentLines = lines
+	return tb
+}
+
+// Member adds a member to a struct type.
+func (tb *TypeBuilder) Member(name string, t *Type, tags string, commentLines ...string) *TypeBuilder {
+	tb.t.Members = append(tb.t.Members, Member{
+		Name:         name,
+		Tags:         tags,
+		Type:         t,
+		CommentLines: commentLines,
+	})
+	tb.pb.use(t)
+	return tb
+}
+
+// Embed adds an embedded member to a struct type. As in Go, the member is
+// named after the (pointed-to) type.
+func (tb *TypeBuilder) Embed(t *Type, tags string, commentLines ...string) *TypeBuilder {
+	name := t.Name.Name
+	if t.Kind == Pointer && t.Elem != nil {
+		name = t.Elem.Name.Name
+	}
+	tb.Member(name, t, tags, commentLines...)
+	tb.t.Members[len(tb.t.Members)-1].Embedded = true
+	return tb
+}
+
+// Method adds a method with a value receiver, or a method to an interface.
+func (tb *TypeBuilder) Method(name string, params, results []*Type, commentLines ...string) *TypeBuilder {
+	return tb.method(tb.t, name, params, results, commentLines)
+}
+
+// PointerMethod adds a method with a pointer receiver.
+func (tb *TypeBuilder) PointerMethod(name string, params, results []*Type, commentLines ...string) *TypeBuilder {
+	return tb.method(tb.pb.b.Pointer(tb.t), name, params, results, commentLines)
+}
+
+func (tb *TypeBuilder) method(receiver *Type, name string, params, results []*Type, commentLines []string) *TypeBuilder {
+	if tb.t.Methods == nil {
+		tb.t.Methods = map[string]*Type{}
+	}
+	// Methods are not canonicalized, since each has its own receiver and
+	// comments.
+	tb.t.Methods[name] = &Type{
+		Name: Name{Name: funcTypeName(params, results, false)},
+		Kind: Func,
+		Signature: &Signature{
+			Receiver:     receiver,
+			Parameters:   params,
+			Results:      results,
+			CommentLines: commentLines,
+		},
+		CommentLines: commentLines,
+	}
+	for _, t := range append(append([]*Type{}, params...), results...) {
+		tb.pb.use(t)
+	}
+	return tb
+}
+
+// ConstGroupBuilder adds constants to a single `const ( ... )` declaration.
+type ConstGroupBuilder struct {
+	pb *PackageBuilder
+	g  *ConstGroup
+	// The index of the next spec, i.e. the next value of iota.
+	index int
+}
+
+// Group returns the declaration being built.
+func (cb *ConstGroupBuilder) Group() *ConstGroup {
+	return cb.g
+}
+
+// Package returns the builder of the package this declaration belongs to.
+func (cb *ConstGroupBuilder) Package() *PackageBuilder {
+	return cb.pb
+}
+
+// Constant adds a constant with an explicit value.
+func (cb *ConstGroupBuilder) Constant(name string, t *Type, value constant.Value, commentLines ...string) *ConstGroupBuilder {
+	cb.add(name, t, value, false, commentLines)
+	return cb
+}
+
+// Iota adds constants whose values count up from the current value of iota,
+// as in `A T = iota; B; C`. Names may be "_" to skip a value.
+func (cb *ConstGroupBuilder) Iota(t *Type, names ...string) *ConstGroupBuilder {
+	for _, name := range names {
+		cb.add(name, t, constant.MakeInt64(int64(cb.index)), true, nil)
+	}
+	return cb
+}
+
+func (cb *ConstGroupBuilder) add(name string, t *Type, value constant.Value, usesIota bool, commentLines []string) {
+	index := cb.index
+	cb.index++
+	if name == "_" {
+		return
+	}
+	c := cb.pb.p.Constant(name)
+	c.Underlying = t
+	c.CommentLines = commentLines
+	c.ConstExact = value
+	c.ConstValue = constant.Val(value)
+	c.ConstGroup = cb.g
+	c.ConstIndex = index
+	c.ConstUsesIota = usesIota
+	cb.g.Constants = append(cb.g.Constants, c)
+	cb.pb.use(t)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"go/constant"
+	"reflect"
+	"testing"
+)
+
+func TestUniverseBuilder(t *testing.T) {
+	b := NewUniverseBuilder()
+	obj := b.Package("example.com/meta", "meta").
+		Struct("Object").
+		Member("Name", String, `json:"name"`, "Name is the name.").
+		Type()
+	code := b.Package("example.com/api", "api").Alias("Code", Int).Type()
+	pod := b.Package("example.com/api", "api").
+		Doc("Package api is an API.").
+		Struct("Pod").
+		Comments("Pod is a pod.").
+		Embed(b.Pointer(obj), `json:",inline"`).
+		Member("Labels", b.Map(String, b.Slice(obj)), `json:"labels"`).
+		PointerMethod("DeepCopy", nil, []*Type{b.Pointer(obj)}, "DeepCopy copies.").
+		Type()
+	b.Package("example.com/api", "api").
+		ConstGroup("+enum").
+		Iota(code, "CodeA", "_", "CodeC").
+		Constant("CodeBig", code, constant.MakeInt64(100)).
+		Package().
+		Function("NewPod", []*Type{String}, []*Type{b.Pointer(pod), b.Universe().Type(Name{Name: "error"})})
+
+	u := b.Universe()
+	api := u.Package("example.com/api")
+	if e, a := "api", api.Name; e != a {
+		t.Errorf("wanted package name %q, got %q", e, a)
+	}
+	if e, a := []string{"Package api is an API."}, api.DocComments; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted doc %q, got %q", e, a)
+	}
+	if !api.HasImport("example.com/meta") || len(api.Imports) != 1 {
+		t.Errorf("wanted a single import of example.com/meta, got %v", api.Imports)
+	}
+	if u.Type(Name{Package: "example.com/api", Name: "Pod"}) != pod || pod.Kind != Struct {
+		t.Errorf("Pod is not a canonical struct: %#v", pod)
+	}
+	if e, a := []string{"Pod is a pod."}, pod.CommentLines; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted comments %q, got %q", e, a)
+	}
+
+	embedded := pod.Members[0]
+	if !embedded.Embedded || embedded.Name != "Object" || embedded.Type.Kind != Pointer || embedded.Type.Elem != obj {
+		t.Errorf("wrong embedded member: %#v", embedded)
+	}
+	labels := pod.Members[1].Type
+	if e, a := "map[string][]example.com/meta.Object", labels.Name.Name; e != a {
+		t.Errorf("wanted map named %q, got %q", e, a)
+	}
+	if labels != b.Map(String, b.Slice(obj)) || labels.Key != String || labels.Elem.Elem != obj {
+		t.Errorf("map type is not canonical: %#v", labels)
+	}
+
+	m := pod.Methods["DeepCopy"]
+	if m == nil || m.Kind != Func || m.Signature.Receiver != b.Pointer(pod) || m.Signature.Results[0] != b.Pointer(obj) {
+		t.Fatalf("wrong method: %#v", m)
+	}
+	if e, a := "func() *example.com/meta.Object", m.Name.Name; e != a {
+		t.Errorf("wanted method type named %q, got %q", e, a)
+	}
+
+	if e, a := Alias, code.Kind; e != a || code.Underlying != Int {
+		t.Errorf("wrong alias: %#v", code)
+	}
+	enum := u.Enum(code)
+	if enum == nil || len(enum.Groups) != 1 {
+		t.Fatalf("wanted one enum group, got %#v", enum)
+	}
+	values := []string{}
+	for _, c := range enum.Values() {
+		values = append(values, c.Name.Name+"="+c.ConstExact.String())
+	}
+	if e, a := []string{"CodeA=0", "CodeC=2", "CodeBig=100"}, values; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted values %v, got %v", e, a)
+	}
+	if c := api.Constants["CodeC"]; c.ConstIndex != 2 || !c.ConstUsesIota || c.ConstValue != int64(2) {
+		t.Errorf("wrong iota constant: %#v", c)
+	}
+
+	f := api.Functions["NewPod"]
+	if f == nil || f.Kind != DeclarationOf || f.Underlying.Kind != Func {
+		t.Fatalf("wrong function: %#v", f)
+	}
+	if e, a := "func(string) (*example.com/api.Pod, error)", f.Underlying.Name.Name; e != a {
+		t.Errorf("wanted function type named %q, got %q", e, a)
+	}
+}
+
+func TestUniverseBuilderVariadicFunc(t *testing.T) {
+	b := NewUniverseBuilder()
+	f := b.VariadicFunc([]*Type{String, b.Slice(Int)}, []*Type{Bool})
+	if e, a := "func(string, ...int) bool", f.Name.Name; e != a {
+		t.Errorf("wanted name %q, got %q", e, a)
+	}
+	if !f.Signature.Variadic || f.Signature.Parameters[1] != b.Slice(Int) {
+		t.Errorf("unexpected signature: %#v", f.Signature)
+	}
+	if g := b.Func([]*Type{String, b.Slice(Int)}, []*Type{Bool}); g == f || g.Signature.Variadic {
+		t.Errorf("expected a distinct, non-variadic function type, got %#v", g)
+	}
+}
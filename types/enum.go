@@ -0,0 +1,190 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"go/constant"
+	"sort"
+)
+
+// Enum is the set of constants declared with a particular named type.
+type Enum struct {
+	// The named type of the constants.
+	Type *Type
+
+	// The constants, grouped by the declaration they appear in. Groups are
+	// ordered by package path and then by their position in the package;
+	// constants keep their declaration order.
+	Groups []EnumGroup
+
+	// Ranges of integer values between the smallest and largest value of
+	// the enum which no constant has. Only computed for integer enums.
+	Gaps []EnumGap
+
+	// Sets of constants which share the same value, in declaration order.
+	Duplicates [][]*Type
+}
+
+// EnumGroup is the part of a const declaration which belongs to an Enum.
+type EnumGroup struct {
+	// The declaration, if known. Constants which were not declared in a
+	// known group are collected into a group with a nil ConstGroup.
+	ConstGroup *ConstGroup
+
+	// The constants of the enum's type, in declaration order.
+	Values []*Type
+}
+
+// EnumGap is an inclusive range of integer values.
+type EnumGap struct {
+	From, To int64
+}
+
+// Values returns all constants of the enum, in order.
+func (e *Enum) Values() []*Type {
+	out := []*Type{}
+	for _, g := range e.Groups {
+		out = append(out, g.Values...)
+	}
+	return out
+}
+
+// Tags returns the comment tags (see ExtractCommentTags) of the given enum
+// value. The comments of the value's declaration are consulted after those of
+// the value itself, so e.g. a tag on a const ( ... ) block applies to all of
+// its values.
+func (e *Enum) Tags(marker string, value *Type) map[string][]string {
+	lines := append([]string{}, value.CommentLines...)
+	if value.ConstGroup != nil {
+		lines = append(lines, value.ConstGroup.CommentLines...)
+	}
+	return ExtractCommentTags(marker, lines)
+}
+
+// Enum returns the constants in the universe whose type is t. It returns nil
+// if there are none.
+func (u Universe) Enum(t *Type) *Enum {
+	pkgPaths := []string{}
+	for path := range u {
+		pkgPaths = append(pkgPaths, path)
+	}
+	sort.Strings(pkgPaths)
+
+	e := &Enum{Type: t}
+	for _, path := range pkgPaths {
+		pkg := u[path]
+		seen := map[*Type]bool{}
+		for _, cg := range pkg.ConstGroups {
+			g := EnumGroup{ConstGroup: cg}
+			for _, c := range cg.Constants {
+				seen[c] = true
+				if c.Underlying == t {
+					g.Values = append(g.Values, c)
+				}
+			}
+			if len(g.Values) > 0 {
+				e.Groups = append(e.Groups, g)
+			}
+		}
+
+		// Pick up constants which aren't part of a known declaration, in
+		// name order.
+		names := []string{}
+		for name, c := range pkg.Constants {
+			if !seen[c] && c.Underlying == t {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			sort.Strings(names)
+			g := EnumGroup{}
+			for _, name := range names {
+				g.Values = append(g.Values, pkg.Constants[name])
+			}
+			e.Groups = append(e.Groups, g)
+		}
+	}
+	if len(e.Groups) == 0 {
+		return nil
+	}
+	e.Duplicates = findDuplicates(e.Values())
+	e.Gaps = findGaps(e.Values())
+	return e
+}
+
+func constantValue(c *Type) constant.Value {
+	if c.ConstExact != nil {
+		return c.ConstExact
+	}
+	switch v := c.ConstValue.(type) {
+	case int64:
+		return constant.MakeInt64(v)
+	case string:
+		return constant.MakeString(v)
+	case bool:
+		return constant.MakeBool(v)
+	}
+	return constant.MakeUnknown()
+}
+
+func findDuplicates(values []*Type) [][]*Type {
+	byValue := map[string][]*Type{}
+	keys := []string{}
+	for _, c := range values {
+		v := constantValue(c)
+		if v.Kind() == constant.Unknown {
+			continue
+		}
+		k := v.ExactString()
+		if _, found := byValue[k]; !found {
+			keys = append(keys, k)
+		}
+		byValue[k] = append(byValue[k], c)
+	}
+	out := [][]*Type{}
+	for _, k := range keys {
+		if len(byValue[k]) > 1 {
+			out = append(out, byValue[k])
+		}
+	}
+	return out
+}
+
+func findGaps(values []*Type) []EnumGap {
+	ints := []int64{}
+	for _, c := range values {
+		v := constantValue(c)
+		if v.Kind() != constant.Int {
+			return nil
+		}
+		i, exact := constant.Int64Val(v)
+		if !exact {
+			return nil
+		}
+		ints = append(ints, i)
+	}
+	sort.Slice(ints, func(i, j int) bool { return ints[i] < ints[j] })
+	gaps := []EnumGap{}
+	for i := 1; i < len(ints); i++ {
+		// Comparing rather than subtracting can't overflow: lo+1 is only
+		// computed when lo < hi.
+		if lo, hi := ints[i-1], ints[i]; lo < hi && lo+1 < hi {
+			gaps = append(gaps, EnumGap{From: lo + 1, To: hi - 1})
+		}
+	}
+	return gaps
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"go/constant"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEnum(t *testing.T) {
+	u := Universe{}
+	pkg := u.Package("example.com/codes")
+	code := u.Type(Name{Package: pkg.Path, Name: "Code"})
+	code.Kind = Alias
+	code.Underlying = Int
+
+	addGroup := func(comments []string, values map[string]int64, order ...string) *ConstGroup {
+		g := &ConstGroup{Package: pkg.Path, CommentLines: comments}
+		for i, name := range order {
+			c := pkg.Constant(name)
+			c.Underlying = code
+			c.ConstExact = constant.MakeInt64(values[name])
+			c.ConstGroup = g
+			c.ConstIndex = i
+			g.Constants = append(g.Constants, c)
+		}
+		pkg.ConstGroups = append(pkg.ConstGroups, g)
+		return g
+	}
+	g1 := addGroup([]string{"+module=rbd"}, map[string]int64{"B": 1, "A": 2}, "B", "A")
+	other := pkg.Constant("Other")
+	other.Underlying = String
+	other.ConstExact = constant.MakeString("x")
+	g1.Constants = append(g1.Constants, other)
+	g2 := addGroup(nil, map[string]int64{"E": 5, "F": 2}, "E", "F")
+	loose := pkg.Constant("Loose")
+	loose.Underlying = code
+	loose.ConstValue = int64(9)
+	loose.CommentLines = []string{"+deprecated"}
+
+	e := u.Enum(code)
+	if e == nil {
+		t.Fatal("expected an enum")
+	}
+	expectedGroups := []EnumGroup{
+		{ConstGroup: g1, Values: []*Type{pkg.Constants["B"], pkg.Constants["A"]}},
+		{ConstGroup: g2, Values: []*Type{pkg.Constants["E"], pkg.Constants["F"]}},
+		{Values: []*Type{loose}},
+	}
+	if !reflect.DeepEqual(expectedGroups, e.Groups) {
+		t.Errorf("wanted groups %v, got %v", expectedGroups, e.Groups)
+	}
+	if e, a := []EnumGap{{3, 4}, {6, 8}}, e.Gaps; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted gaps %v, got %v", e, a)
+	}
+	if e, a := [][]*Type{{pkg.Constants["A"], pkg.Constants["F"]}}, e.Duplicates; !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted duplicates %v, got %v", e, a)
+	}
+	if e, a := map[string][]string{"module": {"rbd"}}, e.Tags("+", pkg.Constants["A"]); !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted tags %v, got %v", e, a)
+	}
+	if e, a := map[string][]string{"deprecated": {""}}, e.Tags("+", loose); !reflect.DeepEqual(e, a) {
+		t.Errorf("wanted tags %v, got %v", e, a)
+	}
+	if e, a := 5, len(e.Values()); e != a {
+		t.Errorf("wanted %v values, got %v", e, a)
+	}
+
+	if e := u.Enum(Bool); e != nil {
+		t.Errorf("expected no enum, got %#v", e)
+	}
+}
+
+func TestFindGapsExtremes(t *testing.T) {
+	table := []struct {
+		values []int64
+		gaps   []EnumGap
+	}{
+		{[]int64{math.MinInt64, math.MaxInt64}, []EnumGap{{math.MinInt64 + 1, math.MaxInt64 - 1}}},
+		{[]int64{math.MinInt64, math.MinInt64 + 1, math.MinInt64}, []EnumGap{}},
+		{[]int64{math.MaxInt64, math.MaxInt64 - 1, math.MaxInt64}, []EnumGap{}},
+		{[]int64{-1, math.MaxInt64}, []EnumGap{{0, math.MaxInt64 - 1}}},
+	}
+	for _, tc := range table {
+		values := []*Type{}
+		for _, v := range tc.values {
+			values = append(values, &Type{Kind: DeclarationOf, ConstExact: constant.MakeInt64(v)})
+		}
+		if e, a := tc.gaps, findGaps(values); !reflect.DeepEqual(e, a) {
+			t.Errorf("%v: wanted gaps %v, got %v", tc.values, e, a)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+// Layout is the memory layout of a type on a particular architecture, as
+// computed by the compiler's sizing rules.
+type Layout struct {
+	// Size of a value of the type, in bytes.
+	Size int64
+
+	// Required alignment of a value of the type, in bytes.
+	Align int64
+
+	// If the type is a struct, the byte offset of each member, in the same
+	// order as Type.Members.
+	Offsets []int64
+}
+
+// StructPadding returns the number of bytes of the struct type t which are not
+// occupied by any member, including trailing padding, and whether the layout
+// of t and of all of its members is known.
+func (u Universe) StructPadding(t *Type) (int64, bool) {
+	l := u.Layout(t)
+	if l == nil || t.Kind != Struct || len(l.Offsets) != len(t.Members) {
+		return 0, false
+	}
+	used := int64(0)
+	for _, m := range t.Members {
+		ml := u.Layout(m.Type)
+		if ml == nil {
+			return 0, false
+		}
+		used += ml.Size
+	}
+	return l.Size - used, true
+}
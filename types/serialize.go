@@ -0,0 +1,534 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// UniverseEncodingVersion identifies the format written by MarshalUniverse.
+// It changes whenever a change to the format would make it unreadable by
+// older versions of UnmarshalUniverse.
+const UniverseEncodingVersion = "gengo/universe/v1"
+
+// The encoded form of a Universe is a JSON object of the form:
+//
+//	{
+//	  "version": "gengo/universe/v1",
+//	  "packages": [ <package>, ... ],
+//	  "types": [ <type>, ... ]
+//	}
+//
+// Types refer to each other (and packages refer to types) by id, which is the
+// 1-based index of the type in "types"; an id of 0 (or a missing field) is a
+// nil *Type. Every *Type appears exactly once, so pointer identity (and any
+// cycles) are preserved. Builtin types decode to the package-level builtins
+// (String, Int64, ...), so they can still be compared by pointer.
+//
+// A <package> has the fields of Package, with Types, Functions, Variables and
+// Constants as maps from name to id, Imports as a list of package paths and
+// ConstGroups as objects holding the ids of their constants. A <type> has the
+// fields of Type; the ConstGroup of a constant is referred to by the index of
+// the group in its package's "constGroups". Constant values are encoded as
+// {"kind": <constant.Kind>, "value": <string>}, where the value of a numeric
+// constant is an exact fraction ("1/3"), and a complex constant also has an
+// "imag" part.
+//
+// Packages and types are written in a deterministic order, so the encoding of
+// a given universe is stable and can be compared textually.
+
+type universeJSON struct {
+	Version  string         `json:"version"`
+	Packages []*packageJSON `json:"packages"`
+	Types    []*typeJSON    `json:"types"`
+}
+
+type packageJSON struct {
+	Path        string                `json:"path"`
+	SourcePath  string                `json:"sourcePath,omitempty"`
+	Name        string                `json:"name,omitempty"`
+	DocComments []string              `json:"docComments,omitempty"`
+	Comments    []string              `json:"comments,omitempty"`
+	Types       map[string]int        `json:"types,omitempty"`
+	Functions   map[string]int        `json:"functions,omitempty"`
+	Variables   map[string]int        `json:"variables,omitempty"`
+	Constants   map[string]int        `json:"constants,omitempty"`
+	Imports     []string              `json:"imports,omitempty"`
+	ConstGroups []*constGroupJSON     `json:"constGroups,omitempty"`
+	Layouts     map[string]layoutJSON `json:"layouts,omitempty"`
+}
+
+type constGroupJSON struct {
+	CommentLines []string `json:"commentLines,omitempty"`
+	Constants    []int    `json:"constants"`
+}
+
+type layoutJSON struct {
+	Size    int64   `json:"size"`
+	Align   int64   `json:"align"`
+	Offsets []int64 `json:"offsets,omitempty"`
+}
+
+type typeJSON struct {
+	Name                      nameJSON       `json:"name"`
+	Kind                      Kind           `json:"kind"`
+	CommentLines              []string       `json:"commentLines,omitempty"`
+	SecondClosestCommentLines []string       `json:"secondClosestCommentLines,omitempty"`
+	Position                  *positionJSON  `json:"position,omitempty"`
+	Members                   []memberJSON   `json:"members,omitempty"`
+	Elem                      int            `json:"elem,omitempty"`
+	Key                       int            `json:"key,omitempty"`
+	Underlying                int            `json:"underlying,omitempty"`
+	Methods                   map[string]int `json:"methods,omitempty"`
+	Signature                 *signatureJSON `json:"signature,omitempty"`
+	ConstValue                *constantJSON  `json:"constValue,omitempty"`
+	ConstGroup                *int           `json:"constGroup,omitempty"`
+	ConstIndex                int            `json:"constIndex,omitempty"`
+	ConstUsesIota             bool           `json:"constUsesIota,omitempty"`
+}
+
+type positionJSON struct {
+	Filename string `json:"filename"`
+	Offset   int    `json:"offset,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+}
+
+type nameJSON struct {
+	Package string `json:"package,omitempty"`
+	Name    string `json:"name"`
+	Path    string `json:"path,omitempty"`
+}
+
+type memberJSON struct {
+	Name         string   `json:"name"`
+	Embedded     bool     `json:"embedded,omitempty"`
+	CommentLines []string `json:"commentLines,omitempty"`
+	Tags         string   `json:"tags,omitempty"`
+	Type         int      `json:"type"`
+}
+
+type signatureJSON struct {
+	Receiver     int      `json:"receiver,omitempty"`
+	Parameters   []int    `json:"parameters,omitempty"`
+	Results      []int    `json:"results,omitempty"`
+	Variadic     bool     `json:"variadic,omitempty"`
+	CommentLines []string `json:"commentLines,omitempty"`
+}
+
+type constantJSON struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+	Imag  string `json:"imag,omitempty"`
+}
+
+// MarshalUniverse encodes u in the format described by
+// UniverseEncodingVersion.
+func MarshalUniverse(u Universe) ([]byte, error) {
+	e := &universeEncoder{ids: map[*Type]int{}, groups: map[*ConstGroup]int{}}
+	out := &universeJSON{Version: UniverseEncodingVersion}
+
+	paths := []string{}
+	for path := range u {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		out.Packages = append(out.Packages, e.encodePackage(u[path]))
+	}
+	// Encoding a type may discover new ones, which are appended to e.types.
+	for i := 0; i < len(e.types); i++ {
+		t, err := e.encodeType(e.types[i])
+		if err != nil {
+			return nil, err
+		}
+		out.Types = append(out.Types, t)
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+type universeEncoder struct {
+	ids   map[*Type]int
+	types []*Type
+	// The index of each const group within its package.
+	groups map[*ConstGroup]int
+}
+
+func (e *universeEncoder) ref(t *Type) int {
+	if t == nil {
+		return 0
+	}
+	if id, found := e.ids[t]; found {
+		return id
+	}
+	e.types = append(e.types, t)
+	e.ids[t] = len(e.types)
+	return len(e.types)
+}
+
+func (e *universeEncoder) refs(ts []*Type) []int {
+	if ts == nil {
+		return nil
+	}
+	out := make([]int, len(ts))
+	for i := range ts {
+		out[i] = e.ref(ts[i])
+	}
+	return out
+}
+
+func (e *universeEncoder) refMap(m map[string]*Type) map[string]int {
+	if len(m) == 0 {
+		return nil
+	}
+	names := []string{}
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := map[string]int{}
+	for _, name := range names {
+		out[name] = e.ref(m[name])
+	}
+	return out
+}
+
+func (e *universeEncoder) encodePackage(p *Package) *packageJSON {
+	out := &packageJSON{
+		Path:        p.Path,
+		SourcePath:  p.SourcePath,
+		Name:        p.Name,
+		DocComments: p.DocComments,
+		Comments:    p.Comments,
+		Types:       e.refMap(p.Types),
+		Functions:   e.refMap(p.Functions),
+		Variables:   e.refMap(p.Variables),
+		Constants:   e.refMap(p.Constants),
+	}
+	for path := range p.Imports {
+		out.Imports = append(out.Imports, path)
+	}
+	sort.Strings(out.Imports)
+	for i, g := range p.ConstGroups {
+		e.groups[g] = i
+		out.ConstGroups = append(out.ConstGroups, &constGroupJSON{
+			CommentLines: g.CommentLines,
+			Constants:    e.refs(g.Constants),
+		})
+	}
+	for name, l := range p.Layouts {
+		if out.Layouts == nil {
+			out.Layouts = map[string]layoutJSON{}
+		}
+		out.Layouts[name] = layoutJSON{Size: l.Size, Align: l.Align, Offsets: l.Offsets}
+	}
+	return out
+}
+
+func (e *universeEncoder) encodeType(t *Type) (*typeJSON, error) {
+	out := &typeJSON{
+		Name:                      nameJSON{Package: t.Name.Package, Name: t.Name.Name, Path: t.Name.Path},
+		Kind:                      t.Kind,
+		CommentLines:              t.CommentLines,
+		SecondClosestCommentLines: t.SecondClosestCommentLines,
+		Elem:                      e.ref(t.Elem),
+		Key:                       e.ref(t.Key),
+		Underlying:                e.ref(t.Underlying),
+		Methods:                   e.refMap(t.Methods),
+		ConstIndex:                t.ConstIndex,
+		ConstUsesIota:             t.ConstUsesIota,
+	}
+	if t.Position.IsValid() {
+		p := t.Position
+		out.Position = &positionJSON{Filename: p.Filename, Offset: p.Offset, Line: p.Line, Column: p.Column}
+	}
+	for _, m := range t.Members {
+		out.Members = append(out.Members, memberJSON{
+			Name:         m.Name,
+			Embedded:     m.Embedded,
+			CommentLines: m.CommentLines,
+			Tags:         m.Tags,
+			Type:         e.ref(m.Type),
+		})
+	}
+	if s := t.Signature; s != nil {
+		out.Signature = &signatureJSON{
+			Receiver:     e.ref(s.Receiver),
+			Parameters:   e.refs(s.Parameters),
+			Results:      e.refs(s.Results),
+			Variadic:     s.Variadic,
+			CommentLines: s.CommentLines,
+		}
+	}
+	if t.ConstExact != nil || t.ConstValue != nil {
+		v := t.ConstExact
+		if v == nil {
+			v = constantValue(t)
+		}
+		c, err := encodeConstant(v)
+		if err != nil {
+			return nil, fmt.Errorf("constant %v: %v", t, err)
+		}
+		out.ConstValue = c
+	}
+	if g := t.ConstGroup; g != nil {
+		i, found := e.groups[g]
+		if !found {
+			return nil, fmt.Errorf("constant %v belongs to a group which is not in package %q", t, g.Package)
+		}
+		out.ConstGroup = &i
+	}
+	return out, nil
+}
+
+func encodeConstant(v constant.Value) (*constantJSON, error) {
+	out := &constantJSON{Kind: v.Kind().String()}
+	switch v.Kind() {
+	case constant.Bool:
+		out.Value = fmt.Sprint(constant.BoolVal(v))
+	case constant.String:
+		out.Value = constant.StringVal(v)
+	case constant.Int, constant.Float:
+		out.Value = ratString(v)
+	case constant.Complex:
+		out.Value = ratString(constant.Real(v))
+		out.Imag = ratString(constant.Imag(v))
+	default:
+		return nil, fmt.Errorf("unsupported constant kind %v", v.Kind())
+	}
+	return out, nil
+}
+
+func ratString(v constant.Value) string {
+	if v.Kind() == constant.Int {
+		return v.ExactString()
+	}
+	num, denom := constant.Num(v), constant.Denom(v)
+	if denom.ExactString() == "1" {
+		return num.ExactString()
+	}
+	return num.ExactString() + "/" + denom.ExactString()
+}
+
+// UnmarshalUniverse decodes a universe encoded by MarshalUniverse.
+func UnmarshalUniverse(data []byte) (Universe, error) {
+	in := &universeJSON{}
+	if err := json.Unmarshal(data, in); err != nil {
+		return nil, err
+	}
+	if in.Version != UniverseEncodingVersion {
+		return nil, fmt.Errorf("unsupported universe encoding %q, expected %q", in.Version, UniverseEncodingVersion)
+	}
+
+	// Allocate every type first, so references can be resolved in any
+	// order.
+	all := make([]*Type, len(in.Types))
+	for i, t := range in.Types {
+		if b, found := builtins.Types[t.Name.Name]; found && t.Name.Package == "" && t.Kind == Builtin {
+			all[i] = b
+			continue
+		}
+		all[i] = &Type{}
+	}
+	d := &universeDecoder{types: all}
+
+	u := Universe{}
+	for _, p := range in.Packages {
+		if err := d.decodePackage(u, p); err != nil {
+			return nil, fmt.Errorf("package %q: %v", p.Path, err)
+		}
+	}
+	for i, t := range in.Types {
+		if isBuiltin(all[i]) {
+			continue
+		}
+		if err := d.decodeType(u, all[i], t); err != nil {
+			return nil, fmt.Errorf("type %d (%v): %v", i+1, t.Name.Name, err)
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return u, nil
+}
+
+func isBuiltin(t *Type) bool {
+	b, found := builtins.Types[t.Name.Name]
+	return found && b == t
+}
+
+type universeDecoder struct {
+	types []*Type
+	// The first invalid reference, if any.
+	err error
+}
+
+func (d *universeDecoder) ref(id int) *Type {
+	if id == 0 {
+		return nil
+	}
+	if id < 0 || id > len(d.types) {
+		if d.err == nil {
+			d.err = fmt.Errorf("reference to unknown type %d", id)
+		}
+		return nil
+	}
+	return d.types[id-1]
+}
+
+func (d *universeDecoder) refs(ids []int) []*Type {
+	if ids == nil {
+		return nil
+	}
+	out := make([]*Type, len(ids))
+	for i := range ids {
+		out[i] = d.ref(ids[i])
+	}
+	return out
+}
+
+func (d *universeDecoder) refMap(in map[string]int, out map[string]*Type) {
+	for name, id := range in {
+		out[name] = d.ref(id)
+	}
+}
+
+func (d *universeDecoder) decodePackage(u Universe, in *packageJSON) error {
+	p := u.Package(in.Path)
+	p.SourcePath = in.SourcePath
+	p.Name = in.Name
+	p.DocComments = in.DocComments
+	p.Comments = in.Comments
+	d.refMap(in.Types, p.Types)
+	d.refMap(in.Functions, p.Functions)
+	d.refMap(in.Variables, p.Variables)
+	d.refMap(in.Constants, p.Constants)
+	u.AddImports(in.Path, in.Imports...)
+	for _, g := range in.ConstGroups {
+		p.ConstGroups = append(p.ConstGroups, &ConstGroup{
+			Package:      in.Path,
+			CommentLines: g.CommentLines,
+			Constants:    d.refs(g.Constants),
+		})
+	}
+	for name, l := range in.Layouts {
+		p.Layouts[name] = &Layout{Size: l.Size, Align: l.Align, Offsets: l.Offsets}
+	}
+	return d.err
+}
+
+func (d *universeDecoder) decodeType(u Universe, t *Type, in *typeJSON) error {
+	t.Name = Name{Package: in.Name.Package, Name: in.Name.Name, Path: in.Name.Path}
+	t.Kind = in.Kind
+	t.CommentLines = in.CommentLines
+	t.SecondClosestCommentLines = in.SecondClosestCommentLines
+	if p := in.Position; p != nil {
+		t.Position = token.Position{Filename: p.Filename, Offset: p.Offset, Line: p.Line, Column: p.Column}
+	}
+	t.Elem = d.ref(in.Elem)
+	t.Key = d.ref(in.Key)
+	t.Underlying = d.ref(in.Underlying)
+	if in.Methods != nil {
+		t.Methods = map[string]*Type{}
+		d.refMap(in.Methods, t.Methods)
+	}
+	for _, m := range in.Members {
+		t.Members = append(t.Members, Member{
+			Name:         m.Name,
+			Embedded:     m.Embedded,
+			CommentLines: m.CommentLines,
+			Tags:         m.Tags,
+			Type:         d.ref(m.Type),
+		})
+	}
+	if s := in.Signature; s != nil {
+		t.Signature = &Signature{
+			Receiver:     d.ref(s.Receiver),
+			Parameters:   d.refs(s.Parameters),
+			Results:      d.refs(s.Results),
+			Variadic:     s.Variadic,
+			CommentLines: s.CommentLines,
+		}
+	}
+	if in.ConstValue != nil {
+		v, err := decodeConstant(in.ConstValue)
+		if err != nil {
+			return err
+		}
+		t.ConstExact = v
+		t.ConstValue = constant.Val(v)
+	}
+	if in.ConstGroup != nil {
+		p, found := u[t.Name.Package]
+		if !found || *in.ConstGroup < 0 || *in.ConstGroup >= len(p.ConstGroups) {
+			return fmt.Errorf("unknown const group %d", *in.ConstGroup)
+		}
+		t.ConstGroup = p.ConstGroups[*in.ConstGroup]
+	}
+	t.ConstIndex = in.ConstIndex
+	t.ConstUsesIota = in.ConstUsesIota
+	return d.err
+}
+
+func decodeConstant(in *constantJSON) (constant.Value, error) {
+	switch in.Kind {
+	case constant.Bool.String():
+		return constant.MakeBool(in.Value == "true"), nil
+	case constant.String.String():
+		return constant.MakeString(in.Value), nil
+	case constant.Int.String():
+		return parseRat(in.Value)
+	case constant.Float.String():
+		v, err := parseRat(in.Value)
+		if err != nil {
+			return nil, err
+		}
+		return constant.ToFloat(v), nil
+	case constant.Complex.String():
+		re, err := parseRat(in.Value)
+		if err != nil {
+			return nil, err
+		}
+		im, err := parseRat(in.Imag)
+		if err != nil {
+			return nil, err
+		}
+		return constant.BinaryOp(re, token.ADD, constant.MakeImag(im)), nil
+	}
+	return nil, fmt.Errorf("unsupported constant kind %q", in.Kind)
+}
+
+func parseRat(s string) (constant.Value, error) {
+	parts := strings.SplitN(s, "/", 2)
+	num := constant.MakeFromLiteral(parts[0], token.INT, 0)
+	if num.Kind() != constant.Int {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	if len(parts) == 1 {
+		return num, nil
+	}
+	denom := constant.MakeFromLiteral(parts[1], token.INT, 0)
+	if denom.Kind() != constant.Int || constant.Sign(denom) == 0 {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return constant.BinaryOp(num, token.QUO, denom), nil
+}
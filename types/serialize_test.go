@@ -0,0 +1,90 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"go/constant"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestMarshalUniverse(t *testing.T) {
+	b := NewUniverseBuilder()
+	node := b.Package("example.com/list", "list").Struct("Node").Type()
+	b.Package("example.com/list", "list").Struct("Node").
+		Member("Next", b.Pointer(node), `json:"next"`, "Next is the next node.").
+		Member("Value", Float64, "")
+	level := b.Package("example.com/list", "list").Alias("Level", Int).Type()
+	b.Package("example.com/list", "list").
+		ConstGroup("+enum").
+		Iota(level, "Low", "_", "High").
+		Constant("Third", Float64, constant.BinaryOp(constant.MakeInt64(1), token.QUO, constant.MakeInt64(3))).
+		Constant("Huge", Int, constant.Shift(constant.MakeInt64(1), token.SHL, 100)).
+		Package().
+		Constant("Name", String, constant.MakeString("list\n")).
+		Constant("I", Float64, constant.MakeImag(constant.MakeInt64(2)))
+	b.Package("example.com/list", "list").Package().Layouts["Node"] = &Layout{Size: 16, Align: 8, Offsets: []int64{0, 8}}
+
+	data, err := MarshalUniverse(b.Universe())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"version": "gengo/universe/v1"`) {
+		t.Errorf("encoding has no version:\n%s", data)
+	}
+	u, err := UnmarshalUniverse(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	again, err := MarshalUniverse(u)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("round trip changed the encoding:\n%s\n---\n%s", data, again)
+	}
+
+	list := u["example.com/list"]
+	n := list.Types["Node"]
+	if n == node || n.Members[0].Type.Elem != n {
+		t.Errorf("the cycle through Node.Next was not preserved: %#v", n)
+	}
+	if n.Members[1].Type != Float64 || list.Types["Level"].Underlying != Int {
+		t.Errorf("builtin types were not shared")
+	}
+	if l := u.Layout(n); l == nil || l.Size != 16 || len(l.Offsets) != 2 {
+		t.Errorf("wrong layout: %#v", l)
+	}
+	high := list.Constants["High"]
+	if high.ConstGroup != list.ConstGroups[0] || high.ConstIndex != 2 || !high.ConstUsesIota || high.ConstValue != int64(2) {
+		t.Errorf("wrong constant: %#v", high)
+	}
+	for name, want := range map[string]string{"Third": "1/3", "Huge": "1267650600228229401496703205376", "Name": `"list\n"`, "I": "(0 + 2i)"} {
+		if got := list.Constants[name].ConstExact.ExactString(); got != want {
+			t.Errorf("%s: wanted %s, got %s", name, want, got)
+		}
+	}
+	if e := u.Enum(list.Types["Level"]); e == nil || len(e.Values()) != 2 {
+		t.Errorf("wrong enum: %#v", e)
+	}
+
+	if _, err := UnmarshalUniverse([]byte(`{"version": "gengo/universe/v0"}`)); err == nil {
+		t.Errorf("expected an error for an unknown version")
+	}
+}
@@ -16,7 +16,11 @@ limitations under the License.
 
 package types
 
-import "strings"
+import (
+	"go/constant"
+	"go/token"
+	"strings"
+)
 
 // Ref makes a reference to the given type. It can only be used for e.g.
 // passing to namers.
@@ -142,6 +146,16 @@ type Package struct {
 	// Packages imported by this package, indexed by (canonicalized)
 	// package path.
 	Imports map[string]*Package
+
+	// The `const ( ... )` declarations in this package, in the order they
+	// appear in the source. A constant declared on its own forms a group of
+	// one.
+	ConstGroups []*ConstGroup
+
+	// Memory layout of the types within this package, indexed by their name
+	// (*not* including package name). Only populated if the parser was asked
+	// to compute layouts; see Universe.Layout.
+	Layouts map[string]*Layout
 }
 
 // Has returns true if the given name references a type known to this package.
@@ -255,6 +269,18 @@ func (u Universe) Constant(n Name) *Type {
 	return u.Package(n.Package).Constant(n.Name)
 }
 
+// Layout returns the memory layout of the given type, or nil if no layout was
+// recorded for it. Builtin types share a single Type across universes, so
+// their layouts (like all others) are kept per-Universe rather than on the
+// Type itself.
+func (u Universe) Layout(t *Type) *Layout {
+	p, ok := u[t.Name.Package]
+	if !ok {
+		return nil
+	}
+	return p.Layouts[t.Name.Name]
+}
+
 // AddImports registers import lines for packageName. May be called multiple times.
 // You are responsible for canonicalizing all package paths.
 func (u Universe) AddImports(packagePath string, importPaths ...string) {
@@ -279,6 +305,7 @@ func (u Universe) Package(packagePath string) *Package {
 		Variables: map[string]*Type{},
 		Constants: map[string]*Type{},
 		Imports:   map[string]*Package{},
+		Layouts:   map[string]*Layout{},
 	}
 	u[packagePath] = p
 	return p
@@ -320,6 +347,10 @@ type Type struct {
 	// ---
 	SecondClosestCommentLines []string
 
+	// Where the type, or the declaration, is declared, if it was parsed
+	// from source.
+	Position token.Position
+
 	// If Kind == Struct
 	Members []Member
 
@@ -344,6 +375,23 @@ type Type struct {
 	// If Kind == DeclarationOf and const type
 	ConstValue interface{}
 
+	// If Kind == DeclarationOf and const type, this is the exact value of the
+	// constant. Unlike ConstValue, it does not lose precision for large or
+	// floating point values.
+	ConstExact constant.Value
+
+	// If Kind == DeclarationOf and const type, this is the declaration block
+	// the constant belongs to, if known.
+	ConstGroup *ConstGroup
+
+	// If Kind == DeclarationOf and const type, this is the index of the
+	// constant's spec within ConstGroup, i.e. the value of iota for it.
+	ConstIndex int
+
+	// If Kind == DeclarationOf and const type, this is true if the constant's
+	// value expression (explicit or implicitly repeated) refers to iota.
+	ConstUsesIota bool
+
 	// TODO: Add:
 	// * channel direction
 	// * array length
@@ -413,6 +461,28 @@ func (m Member) String() string {
 	return m.Name + " " + m.Type.String()
 }
 
+// ConstGroup is a single constant declaration, e.g.:
+//
+//	const (
+//	    A Code = iota
+//	    B
+//	)
+//
+// The type of each constant is the Underlying of its Type.
+type ConstGroup struct {
+	// The package this group was declared in.
+	Package string
+
+	// If there are comment lines immediately before the declaration, they
+	// will be recorded here.
+	CommentLines []string
+
+	// The constants declared by this group, in the order they appear.
+	// Blank (`_`) constants are omitted, but still count towards the
+	// ConstIndex of the constants after them.
+	Constants []*Type
+}
+
 // Signature is a function's signature.
 type Signature struct {
 	// TODO: store the parameter names, not just types.